@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"time"
+
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/message/styling"
+	"github.com/gotd/td/telegram/message/unpack"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/telegram/uploader"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// backupIndexCaption is caption of index message in backup channel.
+const backupIndexCaption = "telegifdl index"
+
+// backupIndexEntry is single gif in backup channel index.
+type backupIndexEntry struct {
+	ID        int64     `json:"id"`
+	MessageID int       `json:"message_id"`
+	Date      time.Time `json:"date"`
+}
+
+// findBackupChannel returns channel with provided title, creating new
+// private channel if not found and create is true.
+//
+// Only own channels are considered when create is true, so backup is never
+// written to somebody else's channel.
+func (a *app) findBackupChannel(ctx context.Context, title string, create bool) (*tg.Channel, error) {
+	iter := dialogs.NewQueryBuilder(a.api).GetDialogs().BatchSize(100).Iter()
+	for iter.Next(ctx) {
+		elem := iter.Value()
+		p, ok := elem.Peer.(*tg.InputPeerChannel)
+		if !ok {
+			continue
+		}
+		ch, ok := elem.Entities.Channel(p.ChannelID)
+		if ok && ch.Title == title && (ch.Creator || !create) {
+			return ch, nil
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, xerrors.Errorf("dialogs: %w", err)
+	}
+
+	if !create {
+		return nil, xerrors.Errorf("channel %q not found", title)
+	}
+
+	a.log.Info("Creating backup channel", zap.String("title", title))
+	updates, err := a.api.ChannelsCreateChannel(ctx, &tg.ChannelsCreateChannelRequest{
+		Broadcast: true,
+		Title:     title,
+		About:     "Saved gifs backup",
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("create: %w", err)
+	}
+	if u, ok := updates.(*tg.Updates); ok {
+		for _, chat := range u.Chats {
+			if ch, ok := chat.(*tg.Channel); ok {
+				return ch, nil
+			}
+		}
+	}
+	return nil, xerrors.Errorf("unexpected create result %T", updates)
+}
+
+// backupMessage is gif message in backup channel.
+type backupMessage struct {
+	MessageID int
+	Doc       *tg.Document
+}
+
+// backupMessages returns gif messages from backup channel, oldest first, and
+// IDs of index messages.
+func (a *app) backupMessages(ctx context.Context, peer tg.InputPeerClass) ([]backupMessage, []int, error) {
+	var (
+		gifs  []backupMessage
+		index []int
+	)
+	iter := messages.NewQueryBuilder(a.api).GetHistory(peer).BatchSize(100).Iter()
+	for iter.Next(ctx) {
+		msg, ok := iter.Value().Msg.(*tg.Message)
+		if !ok {
+			continue
+		}
+		if msg.Message == backupIndexCaption {
+			index = append(index, msg.ID)
+			continue
+		}
+		media, ok := msg.Media.(*tg.MessageMediaDocument)
+		if !ok {
+			continue
+		}
+		doc, ok := media.Document.AsNotEmpty()
+		if !ok {
+			continue
+		}
+		gifs = append(gifs, backupMessage{MessageID: msg.ID, Doc: doc})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, nil, xerrors.Errorf("history: %w", err)
+	}
+
+	// History is returned newest first.
+	for i, j := 0, len(gifs)-1; i < j; i, j = i+1, j-1 {
+		gifs[i], gifs[j] = gifs[j], gifs[i]
+	}
+	return gifs, index, nil
+}
+
+// backupChannelCmd copies every saved gif to private channel, one message per
+// gif, and maintains pinned index message there.
+func backupChannelCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		title    = fs.String("title", "telegifdl backup", "title of backup channel, created if not exists")
+		interval = fs.Duration("interval", time.Second, "delay between sent messages")
+	)
+	return func(ctx context.Context, a *app) error {
+		ch, err := a.findBackupChannel(ctx, *title, true)
+		if err != nil {
+			return xerrors.Errorf("channel: %w", err)
+		}
+		peer := ch.AsInputPeer()
+
+		existing, oldIndex, err := a.backupMessages(ctx, peer)
+		if err != nil {
+			return err
+		}
+		backedUp := map[int64]struct{}{}
+		entries := make([]backupIndexEntry, 0, len(existing))
+		for _, m := range existing {
+			backedUp[m.Doc.ID] = struct{}{}
+			entries = append(entries, backupIndexEntry{
+				ID:        m.Doc.ID,
+				MessageID: m.MessageID,
+				Date:      time.Unix(int64(m.Doc.Date), 0),
+			})
+		}
+
+		docs, err := listSavedGifs(ctx, a.api)
+		if err != nil {
+			return err
+		}
+
+		sender := message.NewSender(a.api)
+		sent := 0
+		// Sending oldest first, so channel follows save order.
+		for i := len(docs) - 1; i >= 0; i-- {
+			doc := docs[i]
+			if _, ok := backedUp[doc.ID]; ok {
+				continue
+			}
+
+			var msg *tg.Message
+			if err := a.retryFlood(ctx, func(ctx context.Context) error {
+				msg, err = unpack.Message(sender.To(peer).Media(ctx, message.Document(doc)))
+				return err
+			}); err != nil {
+				return xerrors.Errorf("send %d: %w", doc.ID, err)
+			}
+			entries = append(entries, backupIndexEntry{
+				ID:        doc.ID,
+				MessageID: msg.ID,
+				Date:      time.Unix(int64(doc.Date), 0),
+			})
+			sent++
+			a.log.Info("Backed up", zap.Int64("id", doc.ID))
+
+			if err := a.sleep(ctx, *interval); err != nil {
+				return err
+			}
+		}
+
+		if sent > 0 || len(oldIndex) == 0 {
+			if err := a.writeBackupIndex(ctx, sender, peer, entries, oldIndex); err != nil {
+				return xerrors.Errorf("index: %w", err)
+			}
+		}
+
+		a.log.Info("Backup finished",
+			zap.String("channel", ch.Title),
+			zap.Int("sent", sent),
+			zap.Int("total", len(entries)),
+		)
+		return nil
+	}
+}
+
+// writeBackupIndex uploads index as pinned JSON document, replacing old
+// index messages.
+func (a *app) writeBackupIndex(
+	ctx context.Context,
+	sender *message.Sender,
+	peer tg.InputPeerClass,
+	entries []backupIndexEntry,
+	oldIndex []int,
+) error {
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("encode: %w", err)
+	}
+	f, err := uploader.NewUploader(a.api).FromBytes(ctx, "index.json", data)
+	if err != nil {
+		return xerrors.Errorf("upload: %w", err)
+	}
+	msg, err := unpack.Message(sender.To(peer).Media(ctx,
+		message.UploadedDocument(f, styling.Plain(backupIndexCaption)).
+			MIME("application/json").
+			Filename("index.json"),
+	))
+	if err != nil {
+		return xerrors.Errorf("send: %w", err)
+	}
+	if _, err := a.api.MessagesUpdatePinnedMessage(ctx, &tg.MessagesUpdatePinnedMessageRequest{
+		Silent: true,
+		Peer:   peer,
+		ID:     msg.ID,
+	}); err != nil {
+		return xerrors.Errorf("pin: %w", err)
+	}
+	if len(oldIndex) > 0 {
+		if _, err := sender.To(peer).Revoke().Messages(ctx, oldIndex...); err != nil {
+			return xerrors.Errorf("delete old: %w", err)
+		}
+	}
+	return nil
+}
+
+// restoreChannelCmd saves every gif from backup channel to saved gifs.
+func restoreChannelCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		title    = fs.String("title", "telegifdl backup", "title of backup channel")
+		interval = fs.Duration("interval", time.Second, "delay between saves")
+	)
+	return func(ctx context.Context, a *app) error {
+		ch, err := a.findBackupChannel(ctx, *title, false)
+		if err != nil {
+			return xerrors.Errorf("channel: %w", err)
+		}
+		gifs, _, err := a.backupMessages(ctx, ch.AsInputPeer())
+		if err != nil {
+			return err
+		}
+
+		saved, err := listSavedGifs(ctx, a.api)
+		if err != nil {
+			return err
+		}
+		// Not re-saving existing gifs, because that would change their
+		// order.
+		skip := map[int64]struct{}{}
+		for _, doc := range saved {
+			skip[doc.ID] = struct{}{}
+		}
+
+		restored := 0
+		// Backup is ordered oldest first, so saving in same order restores
+		// original order of saved gifs.
+		for _, m := range gifs {
+			if _, ok := skip[m.Doc.ID]; ok {
+				continue
+			}
+			if err := a.retryFlood(ctx, func(ctx context.Context) error {
+				return saveGif(ctx, a.api, m.Doc, false)
+			}); err != nil {
+				return xerrors.Errorf("save %d: %w", m.Doc.ID, err)
+			}
+			skip[m.Doc.ID] = struct{}{}
+			restored++
+			a.log.Info("Restored", zap.Int64("id", m.Doc.ID))
+
+			if err := a.sleep(ctx, *interval); err != nil {
+				return err
+			}
+		}
+
+		a.log.Info("Restore finished",
+			zap.Int("restored", restored),
+			zap.Int("total", len(gifs)),
+		)
+		return nil
+	}
+}
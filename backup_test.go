@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// historyHandler returns handler of messages.getHistory paginating messages,
+// ordered by ID, newest first as Telegram does.
+func historyHandler(msgs []tg.MessageClass) mockHandler {
+	return func(req bin.Encoder) (bin.Encoder, error) {
+		r := req.(*tg.MessagesGetHistoryRequest)
+		var batch []tg.MessageClass
+		for i := len(msgs) - 1; i >= 0 && len(batch) < r.Limit; i-- {
+			if r.OffsetID != 0 && msgs[i].GetID() >= r.OffsetID {
+				continue
+			}
+			batch = append(batch, msgs[i])
+		}
+		return &tg.MessagesChannelMessages{Count: len(msgs), Messages: batch}, nil
+	}
+}
+
+func TestBackupMessages(t *testing.T) {
+	// gifMessages returns n messages with gifs, every tenth one being index
+	// message.
+	gifMessages := func(n int) []tg.MessageClass {
+		msgs := make([]tg.MessageClass, 0, n)
+		for id := 1; id <= n; id++ {
+			msg := &tg.Message{ID: id, PeerID: &tg.PeerChannel{ChannelID: 1}}
+			if id%10 == 0 {
+				msg.Message = backupIndexCaption
+			} else {
+				msg.Media = &tg.MessageMediaDocument{Document: &tg.Document{ID: int64(id)}}
+			}
+			msgs = append(msgs, msg)
+		}
+		return msgs
+	}
+
+	for _, tt := range []struct {
+		Name     string
+		Messages int
+		Gifs     int
+		Index    int
+	}{
+		{Name: "Empty", Messages: 0},
+		{Name: "Single", Messages: 1, Gifs: 1},
+		{Name: "FullBatch", Messages: 100, Gifs: 90, Index: 10},
+		{Name: "NextBatch", Messages: 101, Gifs: 91, Index: 10},
+		{Name: "SeveralBatches", Messages: 250, Gifs: 225, Index: 25},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			m := newMockInvoker()
+			m.On(tg.MessagesGetHistoryRequestTypeID, historyHandler(gifMessages(tt.Messages)))
+			a := newTestApp(t, m)
+			a.api = tg.NewClient(m)
+
+			gifs, index, err := a.backupMessages(context.Background(), &tg.InputPeerChannel{ChannelID: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(gifs) != tt.Gifs {
+				t.Errorf("Got %d gifs, expected %d", len(gifs), tt.Gifs)
+			}
+			if len(index) != tt.Index {
+				t.Errorf("Got %d index messages, expected %d", len(index), tt.Index)
+			}
+			// Strict order also means that no message is returned twice
+			// by overlapping batches.
+			for i := 1; i < len(gifs); i++ {
+				if gifs[i-1].MessageID >= gifs[i].MessageID {
+					t.Fatalf("Gifs are not ordered oldest first: %d before %d", gifs[i-1].MessageID, gifs[i].MessageID)
+				}
+			}
+		})
+	}
+}
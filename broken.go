@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+// brokenErrors are RPC errors of downloading document that can't be fixed by
+// retrying.
+var brokenErrors = []string{"FILE_ID_INVALID", "LOCATION_INVALID", "MEDIA_EMPTY"}
+
+// brokenReason returns why document of f can't be playable, or empty string
+// if it looks fine.
+func brokenReason(f file) string {
+	if f.Doc == nil {
+		return ""
+	}
+	if f.Doc.Size == 0 {
+		return "zero size"
+	}
+	if f.Meta.Source != "gifs" && f.Meta.Kind != kindGIF {
+		return ""
+	}
+	for _, attr := range f.Doc.Attributes {
+		if _, ok := attr.(*tg.DocumentAttributeVideo); ok {
+			return ""
+		}
+	}
+	return "no video attribute"
+}
+
+// brokenDownload returns why download of f to name failed for broken
+// document, or empty string if err is not caused by document itself.
+func brokenDownload(name string, err error) string {
+	if err != nil {
+		if rpcErr, ok := tgerr.As(err); ok && rpcErr.IsOneOf(brokenErrors...) {
+			return rpcErr.Type
+		}
+		return ""
+	}
+	if stat, err := os.Stat(name); err == nil && stat.Size() == 0 {
+		return "empty download"
+	}
+	return ""
+}
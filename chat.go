@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// searchFilters maps media kinds to messages.search filters.
+var searchFilters = map[string]func() tg.MessagesFilterClass{
+	kindGIF:      func() tg.MessagesFilterClass { return &tg.InputMessagesFilterGif{} },
+	kindPhoto:    func() tg.MessagesFilterClass { return &tg.InputMessagesFilterPhotos{} },
+	kindVideo:    func() tg.MessagesFilterClass { return &tg.InputMessagesFilterVideo{} },
+	kindVoice:    func() tg.MessagesFilterClass { return &tg.InputMessagesFilterVoice{} },
+	kindRound:    func() tg.MessagesFilterClass { return &tg.InputMessagesFilterRoundVideo{} },
+	kindAudio:    func() tg.MessagesFilterClass { return &tg.InputMessagesFilterMusic{} },
+	kindDocument: func() tg.MessagesFilterClass { return &tg.InputMessagesFilterDocument{} },
+}
+
+// parseSince parses date ("2006-01-02"), RFC 3339 timestamp or duration
+// relative to now of clock ("720h").
+func parseSince(c clock.Clock, s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return c.Now().Add(-d), nil
+	}
+	return time.Time{}, xerrors.Errorf("invalid time %q", s)
+}
+
+// peerDir returns directory name for peer.
+func peerDir(peer tg.InputPeerClass) string {
+	switch peer := peer.(type) {
+	case *tg.InputPeerUser:
+		return fmt.Sprintf("user%d", peer.UserID)
+	case *tg.InputPeerChat:
+		return fmt.Sprintf("chat%d", peer.ChatID)
+	case *tg.InputPeerChannel:
+		return fmt.Sprintf("channel%d", peer.ChannelID)
+	default:
+		return "self"
+	}
+}
+
+// chatSearch describes media search in single chat.
+type chatSearch struct {
+	Peer  tg.InputPeerClass
+	Kinds []string
+	Since time.Time
+	// Pinned limits search to pinned messages.
+	Pinned bool
+	// From limits search to messages sent by peer, if not nil.
+	From tg.InputPeerClass
+	// Name is file name template, see nameTemplate.
+	Name string
+}
+
+// chatMedia returns source of media found by search, stored in
+// "chats/<peer>/<kind>" directories.
+func (a *app) chatMedia(s chatSearch) source {
+	dir := filepath.Join("chats", peerDir(s.Peer))
+
+	// Searching once per kind, as messages.search accepts single filter.
+	// Pinned messages can't be filtered by kind on server side, so they
+	// are searched once and filtered by kind here.
+	queries := map[string]tg.MessagesFilterClass{}
+	if s.Pinned {
+		queries["pinned"] = &tg.InputMessagesFilterPinned{}
+	} else {
+		for _, kind := range s.Kinds {
+			queries[kind] = searchFilters[kind]()
+		}
+	}
+	kinds := map[string]struct{}{}
+	for _, kind := range s.Kinds {
+		kinds[kind] = struct{}{}
+	}
+
+	return func(ctx context.Context, files chan<- file) error {
+		// Same message can match several filters, e.g. gif is a document.
+		seen := map[int]struct{}{}
+		for name, filter := range queries {
+			b := messages.NewQueryBuilder(a.api).Search(s.Peer).
+				Filter(filter).
+				BatchSize(100)
+			if !s.Since.IsZero() {
+				b = b.MinDate(int(s.Since.Unix()))
+			}
+			if s.From != nil {
+				b = b.FromID(s.From)
+			}
+
+			count := 0
+			iter := b.Iter()
+			for iter.Next(ctx) {
+				elem := iter.Value()
+				msg, ok := elem.Msg.(*tg.Message)
+				if !ok {
+					continue
+				}
+				if _, ok := seen[msg.ID]; ok {
+					continue
+				}
+				seen[msg.ID] = struct{}{}
+
+				f, ok := messageFile(dir, "chat", msg)
+				if !ok {
+					continue
+				}
+				if _, ok := kinds[f.Meta.Kind]; !ok && s.Pinned {
+					continue
+				}
+				setSender(&f, msg, elem.Entities)
+				f.Refresh = messageRefresher(a.api, s.Peer, msg.ID)
+				if s.Name != "" {
+					f.Name = nameTemplate(s.Name, f)
+				}
+				f.Sidecar = true
+				if err := send(ctx, files, f); err != nil {
+					return err
+				}
+				count++
+			}
+			if err := iter.Err(); err != nil {
+				return xerrors.Errorf("search %s: %w", name, err)
+			}
+			a.log.Info("Searched chat",
+				zap.String("query", name),
+				zap.Int("count", count),
+			)
+		}
+		return nil
+	}
+}
+
+// exportChatCmd downloads media of requested kinds from chat.
+func exportChatCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		types  = fs.String("types", kindGIF, "comma-separated media kinds (gif, photo, video, voice, round, audio, document)")
+		since  = fs.String("since", "", "only media sent after date (2006-01-02), timestamp or duration ago (720h)")
+		pinned = fs.Bool("pinned", false, "only media from pinned messages")
+		from   = fs.String("from", "", "only media sent by user")
+		name   = fs.String("name", "", "file name template: {id}, {msg}, {date}, {sender}, {caption}")
+	)
+	return func(ctx context.Context, a *app) error {
+		if fs.NArg() != 1 {
+			return xerrors.New("usage: export-chat [flags] <peer>")
+		}
+
+		s := chatSearch{Pinned: *pinned, Name: *name}
+		for _, kind := range strings.Split(*types, ",") {
+			kind = strings.TrimSpace(kind)
+			if _, ok := searchFilters[kind]; !ok {
+				return xerrors.Errorf("unknown media kind %q", kind)
+			}
+			s.Kinds = append(s.Kinds, kind)
+		}
+		if *since != "" {
+			t, err := parseSince(a.clock, *since)
+			if err != nil {
+				return err
+			}
+			s.Since = t
+		}
+
+		sender := message.NewSender(a.api)
+		peer, err := sender.Resolve(fs.Arg(0)).AsInputPeer(ctx)
+		if err != nil {
+			return xerrors.Errorf("resolve %q: %w", fs.Arg(0), err)
+		}
+		s.Peer = peer
+		if *from != "" {
+			fromPeer, err := sender.Resolve(*from).AsInputPeer(ctx)
+			if err != nil {
+				return xerrors.Errorf("resolve %q: %w", *from, err)
+			}
+			s.From = fromPeer
+		}
+
+		return a.download(ctx, pipeline{Source: a.chatMedia(s)})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotd/td/clock"
+)
+
+// fixedClock is clock.System stopped at Time.
+type fixedClock struct {
+	clock.Clock
+	Time time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.Time }
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2021, 6, 15, 12, 0, 0, 0, time.UTC)
+	c := fixedClock{Clock: clock.System, Time: now}
+	for _, tt := range []struct {
+		Input  string
+		Result time.Time
+	}{
+		{Input: "2021-06-01", Result: time.Date(2021, 6, 1, 0, 0, 0, 0, time.Local)},
+		{Input: "2021-06-01T10:00:00Z", Result: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)},
+		{Input: "48h", Result: now.Add(-48 * time.Hour)},
+	} {
+		t.Run(tt.Input, func(t *testing.T) {
+			got, err := parseSince(c, tt.Input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.Result) {
+				t.Errorf("Got %s, expected %s", got, tt.Result)
+			}
+		})
+	}
+	if _, err := parseSince(c, "yesterday"); err == nil {
+		t.Error("Expected error")
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// previousRunActions are actions for checkpoint of previous run.
+var previousRunActions = map[string]struct{}{
+	"prompt":  {},
+	"resume":  {},
+	"restart": {},
+	"inspect": {},
+}
+
+// checkpointHeader is first record of checkpoint.
+type checkpointHeader struct {
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+}
+
+// checkpointEntry is record of file completed by run.
+type checkpointEntry struct {
+	Name string `json:"name"`
+}
+
+// previousRun is checkpoint left by run which exited abnormally.
+type previousRun struct {
+	checkpointHeader
+	// Completed are names of completed files relative to output directory.
+	Completed []string
+}
+
+// Summary returns human-readable summary of run.
+func (p *previousRun) Summary() string {
+	var b strings.Builder
+	_, _ = fmt.Fprint(&b, trf("Previous run of %q started at %s did not finish, %d files were completed",
+		p.Command, p.Started.Format(time.RFC3339), len(p.Completed),
+	))
+	if n := len(p.Completed); n > 0 {
+		_, _ = fmt.Fprint(&b, trf(", last one is %s", p.Completed[n-1]))
+	}
+	return b.String()
+}
+
+// readCheckpoint reads checkpoint, returning nil if there is none.
+func readCheckpoint(path string) (*previousRun, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	p := &previousRun{}
+	d := json.NewDecoder(f)
+	if err := d.Decode(&p.checkpointHeader); err != nil {
+		return nil, xerrors.Errorf("decode header: %w", err)
+	}
+	for {
+		var e checkpointEntry
+		if err := d.Decode(&e); err != nil {
+			// Either end of checkpoint, or last record partially written
+			// by crashed run.
+			break
+		}
+		p.Completed = append(p.Completed, e.Name)
+	}
+	return p, nil
+}
+
+// checkpoint records files completed by run, so next run after abnormal
+// exit can offer to resume or restart it.
+type checkpoint struct {
+	mux  sync.Mutex
+	path string
+	f    *os.File
+}
+
+// openCheckpoint opens checkpoint for appending, starting new one with
+// header of command if there is none.
+func openCheckpoint(store storage, path, command string, now time.Time) (*checkpoint, error) {
+	f, err := store.Append(path, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if stat.Size() == 0 {
+		if err := json.NewEncoder(f).Encode(checkpointHeader{Command: command, Started: now}); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+	}
+	return &checkpoint{path: path, f: f}, nil
+}
+
+// Add records completed file.
+func (c *checkpoint) Add(name string) error {
+	if c == nil {
+		return nil
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return json.NewEncoder(c.f).Encode(checkpointEntry{Name: name})
+}
+
+// Close closes checkpoint, keeping it for next run.
+func (c *checkpoint) Close() error {
+	if c == nil {
+		return nil
+	}
+	return c.f.Close()
+}
+
+// Finish removes checkpoint of successfully finished run.
+func (c *checkpoint) Finish() error {
+	if c == nil {
+		return nil
+	}
+	_ = c.f.Close()
+	return os.Remove(c.path)
+}
+
+// openCheckpoint handles checkpoint left by previous run, if any, and opens
+// checkpoint of command, reporting whether command should be run.
+func (a *app) openCheckpoint(command string) (bool, error) {
+	path := filepath.Join(a.opt.Out, ".checkpoint")
+	prev, err := readCheckpoint(path)
+	if err != nil {
+		return false, xerrors.Errorf("read: %w", err)
+	}
+	if prev != nil && len(prev.Completed) == 0 {
+		// Nothing to resume, starting over.
+		if err := os.Remove(path); err != nil {
+			return false, xerrors.Errorf("remove: %w", err)
+		}
+		prev = nil
+	}
+
+	action := a.opt.PreviousRun
+	for prev != nil && (action == "prompt" || action == "inspect") {
+		fmt.Println(prev.Summary())
+		if action == "inspect" {
+			for _, name := range prev.Completed {
+				fmt.Println("  " + name)
+			}
+			if a.opt.PreviousRun == "inspect" {
+				return false, nil
+			}
+		}
+		answer, err := a.prompt.Prompt(tr("Resume, restart or inspect? [R/s/i] "))
+		if err == io.EOF {
+			// Not interactive, resuming as before.
+			answer = ""
+		} else if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "", "r", "resume":
+			action = "resume"
+		case "s", "restart":
+			action = "restart"
+		case "i", "inspect":
+			action = "inspect"
+		}
+	}
+	if prev != nil && action == "restart" {
+		// Completed files are kept: with --rm they can be the only copy.
+		a.log.Info("Restarting previous run, discarding checkpoint", zap.Int("completed", len(prev.Completed)))
+		if err := os.Remove(path); err != nil {
+			return false, xerrors.Errorf("remove: %w", err)
+		}
+	}
+
+	c, err := openCheckpoint(a.store, path, command, a.clock.Now())
+	if err != nil {
+		return false, xerrors.Errorf("open: %w", err)
+	}
+	a.checkpoint = c
+	return true, nil
+}
+
+// finishing wraps handler to remove checkpoint if it succeeds.
+func (a *app) finishing(handler func(ctx context.Context, a *app) error) func(ctx context.Context, a *app) error {
+	return func(ctx context.Context, a *app) error {
+		if err := handler(ctx, a); err != nil {
+			return err
+		}
+		return a.checkpoint.Finish()
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenCheckpointRestart(t *testing.T) {
+	a := newTestApp(t, nil)
+	a.opt.PreviousRun = "restart"
+	if err := os.MkdirAll(a.opt.Out, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	c, err := openCheckpoint(a.store, filepath.Join(a.opt.Out, ".checkpoint"), "download", a.clock.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(a.opt.Out, "1.mp4")
+	if err := os.WriteFile(name, testContent(1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Add("1.mp4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	run, err := a.openCheckpoint("download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !run {
+		t.Fatal("Run is skipped")
+	}
+	defer func() { _ = a.checkpoint.Close() }()
+	// Completed file can be the only copy after removal from account.
+	checkContent(t, name, 1)
+	prev, err := readCheckpoint(filepath.Join(a.opt.Out, ".checkpoint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev == nil || len(prev.Completed) != 0 {
+		t.Errorf("Checkpoint is not restarted: %+v", prev)
+	}
+}
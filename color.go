@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+
+	"github.com/gotd/td/telegram/thumbnail"
+	"github.com/gotd/td/tg"
+)
+
+// hexColor formats color as "#rrggbb".
+func hexColor(r, g, b uint8) string {
+	return fmt.Sprintf("#%02x%02x%02x", r, g, b)
+}
+
+// averageColor returns average color of img.
+func averageColor(img image.Image) string {
+	var r, g, b, n uint64
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			pr, pg, pb, _ := img.At(x, y).RGBA()
+			r, g, b = r+uint64(pr>>8), g+uint64(pg>>8), b+uint64(pb>>8)
+			n++
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+	return hexColor(uint8(r/n), uint8(g/n), uint8(b/n))
+}
+
+// thumbColor returns average color of inlined thumbnail of document, or
+// empty string if document has none.
+func thumbColor(doc *tg.Document) string {
+	for _, size := range doc.Thumbs {
+		var data []byte
+		switch size := size.(type) {
+		case *tg.PhotoStrippedSize:
+			expanded, err := thumbnail.Expand(size.Bytes)
+			if err != nil {
+				continue
+			}
+			data = expanded
+		case *tg.PhotoCachedSize:
+			data = size.Bytes
+		default:
+			continue
+		}
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			continue
+		}
+		return averageColor(img)
+	}
+	return ""
+}
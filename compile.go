@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// clipTitle returns title card text of clip: caption or title from sidecar,
+// date or file name.
+func clipTitle(name string) string {
+	m, err := readSidecar(name)
+	if err != nil {
+		return strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	}
+	if t := xmpTitle(m); t != "" {
+		return t
+	}
+	return m.Date.Format("2006-01-02")
+}
+
+// compileClips returns clips to compile: gifs with provided IDs, gifs
+// listed in manifest or all downloaded gifs.
+func compileClips(dir string, ids []string, manifest string) ([]string, error) {
+	if manifest != "" {
+		listed, err := readManifestIDs(manifest)
+		if err != nil {
+			return nil, xerrors.Errorf("manifest: %w", err)
+		}
+		for _, id := range listed {
+			ids = append(ids, strconv.FormatInt(id, 10))
+		}
+	}
+	if len(ids) > 0 {
+		clips := make([]string, 0, len(ids))
+		for _, id := range ids {
+			clips = append(clips, filepath.Join(dir, id+".mp4"))
+		}
+		return clips, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("dir: %w", err)
+	}
+	var clips []string
+	for _, e := range entries {
+		if !e.IsDir() && filepath.Ext(e.Name()) == ".mp4" {
+			clips = append(clips, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(clips)
+	return clips, nil
+}
+
+// reel is single video compiled from clips.
+type reel struct {
+	Clips []string
+	// Width and Height are even dimensions of video, clips are scaled and
+	// padded to them.
+	Width  int
+	Height int
+	// Titles adds title card of TitleDuration seconds before each clip.
+	Titles        bool
+	TitleDuration float64
+	Output        string
+}
+
+// compileCmd concatenates gifs into single video, scaled and padded to
+// common resolution, optionally preceding each clip with title card.
+func compileCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		output   = fs.String("o", "reel.mp4", "output video")
+		manifest = fs.String("manifest", "", "compile gifs listed in manifest, in order")
+		size     = fs.String("size", "640x480", "resolution of output")
+		titles   = fs.Bool("titles", false, "add title card with caption or date before each clip")
+		cardLen  = fs.Float64("title-duration", 1.5, "title card duration in seconds")
+	)
+	return func(ctx context.Context, a *app) error {
+		if !hasFFmpeg() {
+			return errNoFFmpeg
+		}
+		var w, h int
+		if _, err := fmt.Sscanf(*size, "%dx%d", &w, &h); err != nil || w <= 0 || h <= 0 {
+			return xerrors.Errorf("invalid size %q", *size)
+		}
+		// Keeping dimensions even for yuv420p.
+		w, h = w&^1, h&^1
+
+		clips, err := compileClips(a.opt.Out, fs.Args(), *manifest)
+		if err != nil {
+			return err
+		}
+		if len(clips) == 0 {
+			return xerrors.New("no gifs to compile")
+		}
+
+		return a.compileReel(ctx, reel{
+			Clips:         clips,
+			Width:         w,
+			Height:        h,
+			Titles:        *titles,
+			TitleDuration: *cardLen,
+			Output:        *output,
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// convertFormats are formats downloaded videos can be converted to.
+var convertFormats = map[string]rendition{
+	"gif":  {Format: "gif"},
+	"webp": {Format: "webp"},
+	"apng": {Format: "apng"},
+	"mp4":  {Format: "mp4"},
+}
+
+// convertRendition returns rendition of requested conversion.
+func (a *app) convertRendition() (rendition, error) {
+	r, ok := convertFormats[a.opt.Convert]
+	if !ok {
+		return rendition{}, xerrors.Errorf("unsupported conversion format %q", a.opt.Convert)
+	}
+	if q := a.opt.ConvertQuality; q < 0 || q > 100 {
+		return rendition{}, xerrors.Errorf("invalid quality %d", q)
+	}
+	if a.opt.TargetSize > 0 && r.Format != "mp4" {
+		return rendition{}, xerrors.New("target size is supported only for mp4")
+	}
+	if a.opt.ConvertPlays < 0 {
+		return rendition{}, xerrors.Errorf("invalid plays count %d", a.opt.ConvertPlays)
+	}
+	if c := a.opt.ConvertCRF; c < 0 || c > 63 {
+		return rendition{}, xerrors.Errorf("invalid crf %d", c)
+	}
+	r.Width = a.opt.ConvertScale
+	r.CRF = a.opt.ConvertCRF
+	r.Encoder = a.encoder
+	r.MaxDim = a.opt.ConvertMaxDim
+	r.FPS = a.opt.ConvertFPS
+	r.Plays = a.opt.ConvertPlays
+	r.Quality = a.opt.ConvertQuality
+	return r, nil
+}
+
+// convertedName returns name of converted rendition of video.
+func (a *app) convertedName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + convertFormats[a.opt.Convert].ext()
+}
+
+// convertible reports whether f is video to convert.
+func (a *app) convertible(f file) bool {
+	return strings.HasPrefix(f.Meta.MIME, "video/")
+}
+
+// downloaded reports whether file at name was already downloaded, possibly
+// replaced by its converted rendition.
+func (a *app) downloaded(name string) bool {
+	if _, err := os.Stat(name); err == nil {
+		return true
+	}
+	if !a.opt.ConvertReplace {
+		return false
+	}
+	if a.opt.WebmToMP4 && filepath.Ext(name) == ".webm" {
+		if _, err := os.Stat(webmMP4Name(name)); err == nil {
+			return true
+		}
+	}
+	if a.opt.Convert == "" {
+		return false
+	}
+	_, err := os.Stat(a.convertedName(name))
+	return err == nil
+}
+
+// postprocessing reports whether downloaded videos are processed.
+func (a *app) postprocessing() bool {
+	return a.opt.Convert != "" || a.opt.Posters || a.opt.Provenance || a.opt.Previews > 0 ||
+		a.opt.Sprite.Columns > 0 || a.opt.WebmToMP4
+}
+
+// postprocess runs requested processing of downloaded video f.
+//
+// Provenance is embedded and poster, preview and sprite sheet are
+// extracted first, as conversion can replace video.
+func (a *app) postprocess(ctx context.Context, f file) error {
+	if _, err := os.Stat(filepath.Join(a.opt.Out, f.Name)); os.IsNotExist(err) {
+		// Removed by Done callback, e.g. as duplicate.
+		return nil
+	}
+	if a.opt.Provenance {
+		if err := a.embedProvenance(ctx, f); err != nil {
+			return xerrors.Errorf("provenance: %w", err)
+		}
+	}
+	if a.opt.Posters {
+		if err := a.extractPoster(ctx, f); err != nil {
+			return xerrors.Errorf("poster: %w", err)
+		}
+	}
+	if a.opt.Previews > 0 {
+		if err := a.renderPreview(ctx, f); err != nil {
+			return xerrors.Errorf("preview: %w", err)
+		}
+	}
+	if a.opt.Sprite.Columns > 0 {
+		if err := a.renderSprite(ctx, f); err != nil {
+			return xerrors.Errorf("sprite: %w", err)
+		}
+	}
+	if a.opt.WebmToMP4 && f.Meta.MIME == "video/webm" {
+		// Compatibility conversion takes precedence over requested one.
+		if err := a.webmToMP4(ctx, f); err != nil {
+			return xerrors.Errorf("webm: %w", err)
+		}
+		return nil
+	}
+	if a.opt.Convert != "" {
+		if err := a.convertFile(ctx, f); err != nil {
+			return xerrors.Errorf("convert: %w", err)
+		}
+	}
+	return nil
+}
+
+// convertFile converts downloaded video f to requested format, storing
+// rendition next to it.
+//
+// With target size, videos already fitting into it are skipped and others
+// are encoded with bitrate calculated from duration.
+func (a *app) convertFile(ctx context.Context, f file) error {
+	name := filepath.Join(a.opt.Out, f.Name)
+	stat, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	r, err := a.convertRendition()
+	if err != nil {
+		return err
+	}
+
+	if target := a.opt.TargetSize; target > 0 {
+		if byteSize(stat.Size()) <= target {
+			return nil
+		}
+		if f.Meta.Duration <= 0 {
+			return xerrors.Errorf("%s: unknown duration, can't fit into %s", f.Name, target)
+		}
+		// Leaving 5% for container overhead.
+		r.Bitrate = int(float64(target) * 8 * 0.95 / f.Meta.Duration / 1000)
+	}
+
+	out := a.convertedName(name)
+	if err := convert(ctx, a.store, r, name, out); err != nil {
+		return err
+	}
+	a.log.Info("Converted",
+		zap.String("path", out),
+		zap.Stringer("rendition", r),
+	)
+
+	if a.opt.ConvertReplace && out != name {
+		return os.Remove(name)
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+// duplicate is saved gif that duplicates other, more recently saved one.
+type duplicate struct {
+	Doc *tg.Document
+	// Of is ID of kept document.
+	Of int64
+	// Reason is "content" or "metadata".
+	Reason string
+}
+
+// findDuplicates returns saved gifs that duplicate more recently saved ones.
+//
+// Gifs are same if their downloaded files, found by path, have same content
+// hash or if they have same size, dimensions and duration and content of at
+// most one of them is known. Path returns empty name of gif which is not
+// downloaded.
+func findDuplicates(ctx context.Context, docs []*tg.Document, path func(id int64) (string, error)) ([]duplicate, error) {
+	type keptGif struct {
+		ID   int64
+		Hash string
+	}
+	var (
+		dups       []duplicate
+		byContent  = map[string]int64{}     // hash -> document ID
+		byMetadata = map[string][]keptGif{} // metadata -> kept gifs
+	)
+	for _, doc := range docs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		m := documentMetadata("gifs", doc)
+		meta := fmt.Sprintf("%d:%dx%d:%.1f", m.Size, m.Width, m.Height, m.Duration)
+		var hash string
+		name, err := path(doc.ID)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" {
+			if hash, err = contentHash(name); err != nil {
+				return nil, xerrors.Errorf("hash: %w", err)
+			}
+		}
+
+		if id, ok := byContent[hash]; ok && hash != "" {
+			dups = append(dups, duplicate{Doc: doc, Of: id, Reason: "content"})
+			continue
+		}
+		dup := false
+		for _, k := range byMetadata[meta] {
+			if hash != "" && k.Hash != "" {
+				// Both are downloaded and content differs.
+				continue
+			}
+			dups = append(dups, duplicate{Doc: doc, Of: k.ID, Reason: "metadata"})
+			dup = true
+			break
+		}
+		if dup {
+			continue
+		}
+		if hash != "" {
+			byContent[hash] = doc.ID
+		}
+		byMetadata[meta] = append(byMetadata[meta], keptGif{ID: doc.ID, Hash: hash})
+	}
+	return dups, nil
+}
+
+// dedupeRemoteCmd finds duplicate saved gifs and unsaves them, keeping most
+// recently saved one.
+func dedupeRemoteCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		yes      = fs.Bool("yes", false, "unsave duplicates without confirmation")
+		dryRun   = fs.Bool("dry-run", false, "only report duplicates")
+		interval = fs.Duration("interval", time.Second, "delay between unsaves")
+	)
+	return func(ctx context.Context, a *app) error {
+		docs, err := listSavedGifs(ctx, a.api)
+		if err != nil {
+			return err
+		}
+		profile := a.profileOf(a.api)
+		dups, err := findDuplicates(ctx, docs, func(id int64) (string, error) {
+			name := filepath.Join(a.opt.Out, fmt.Sprintf("%d.mp4", id))
+			if fileExists(name) {
+				return name, nil
+			}
+			// Downloaded elsewhere, e.g. by download with other output.
+			e, ok, err := a.indexed(profile, id)
+			if err != nil || !ok {
+				return "", err
+			}
+			return e.Path, nil
+		})
+		if err != nil {
+			return err
+		}
+		a.log.Info("Found duplicates",
+			zap.Int("count", len(dups)),
+			zap.Int("total", len(docs)),
+		)
+
+		removed := 0
+		for _, d := range dups {
+			fmt.Print(trf("%d duplicates %d (same %s)\n", d.Doc.ID, d.Of, d.Reason))
+			if *dryRun {
+				continue
+			}
+			if d.Reason == "metadata" {
+				// Content of at most one gif is known, so same metadata
+				// alone is confirmed even with --yes.
+				answer, err := a.prompt.Prompt(tr("Content is not compared, unsave anyway? [y/N] "))
+				if err == io.EOF {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				if answer = strings.ToLower(answer); answer != "y" && answer != "yes" {
+					continue
+				}
+			} else if !*yes {
+				answer, err := a.prompt.Prompt(tr("Unsave? [y/N/a(ll)] "))
+				if err != nil {
+					return err
+				}
+				switch strings.ToLower(answer) {
+				case "a", "all":
+					*yes = true
+				case "y", "yes":
+				default:
+					continue
+				}
+			}
+
+			doc := d.Doc
+			if err := a.retryFlood(ctx, func(ctx context.Context) error {
+				return saveGif(ctx, a.api, doc, true)
+			}); err != nil {
+				return xerrors.Errorf("unsave %d: %w", doc.ID, err)
+			}
+			removed++
+			if err := a.sleep(ctx, *interval); err != nil {
+				return err
+			}
+		}
+
+		a.log.Info("Dedupe finished", zap.Int("unsaved", removed))
+		return nil
+	}
+}
+
+// localGif is downloaded gif compared for de-duplication.
+type localGif struct {
+	Name string
+	Size int64
+	// Hash is content hash.
+	Hash string
+	// Frames are perceptual hashes of first frames, if computed.
+	Frames []uint64
+}
+
+// groupLocal groups gifs by content hash or, if maxDistance is not
+// negative, by perceptual hash distance to first gif of group.
+func groupLocal(gifs []localGif, maxDistance int) [][]localGif {
+	var groups [][]localGif
+	byHash := map[string]int{}
+	for _, g := range gifs {
+		i, ok := byHash[g.Hash]
+		if !ok && maxDistance >= 0 {
+			for j, group := range groups {
+				if hashDistance(g.Frames, group[0].Frames) <= maxDistance {
+					i, ok = j, true
+					break
+				}
+			}
+		}
+		if !ok {
+			i = len(groups)
+			groups = append(groups, nil)
+			byHash[g.Hash] = i
+		}
+		groups[i] = append(groups[i], g)
+	}
+	return groups
+}
+
+// sidecarNames returns names of files derived from downloaded gif at name:
+// metadata, poster, XMP and converted renditions next to it, preview and
+// sprite sheet in subdirectories.
+func sidecarNames(name string) []string {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	names := []string{name + ".json", base + ".jpg", base + ".png", xmpName(name), previewName(name), spriteName(name)}
+	names = append(names, strings.TrimSuffix(spriteName(name), ".jpg")+".json")
+	for _, r := range convertFormats {
+		if n := base + r.ext(); n != name {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// quarantine moves gif at name with its sidecars to dir, keeping their
+// layout relative to gif.
+func quarantine(store storage, name, dir string) error {
+	for _, n := range append([]string{name}, sidecarNames(name)...) {
+		if _, err := os.Stat(n); os.IsNotExist(err) {
+			continue
+		}
+		rel, err := filepath.Rel(filepath.Dir(name), n)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, rel)
+		if err := store.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+			return xerrors.Errorf("mkdir: %w", err)
+		}
+		if err := os.Rename(n, target); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// dedupeCmd reports groups of same downloaded gifs, keeping largest one of
+// group and optionally moving others to quarantine directory.
+func dedupeCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		similar  = fs.Bool("similar", false, "also group visually similar gifs by perceptual hash of frames")
+		distance = fs.Int("distance", 6, "maximum mean hash distance (0-64) of similar gifs")
+		dir      = fs.String("quarantine", "", "move duplicates to directory")
+	)
+	return func(ctx context.Context, a *app) error {
+		if *similar && !hasFFmpeg() {
+			return xerrors.Errorf("similar: %w", errNoFFmpeg)
+		}
+		entries, err := os.ReadDir(a.opt.Out)
+		if err != nil {
+			return xerrors.Errorf("dir: %w", err)
+		}
+
+		var (
+			mux  sync.Mutex
+			gifs []localGif
+		)
+		names := make(chan string, a.opt.Jobs)
+		g, gCtx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			defer close(names)
+			for _, e := range entries {
+				if e.IsDir() || filepath.Ext(e.Name()) != ".mp4" {
+					continue
+				}
+				select {
+				case names <- e.Name():
+				case <-gCtx.Done():
+					return gCtx.Err()
+				}
+			}
+			return nil
+		})
+		for j := 0; j < a.opt.Jobs; j++ {
+			g.Go(func() error {
+				for name := range names {
+					path := filepath.Join(a.opt.Out, name)
+					stat, err := os.Stat(path)
+					if err != nil {
+						return err
+					}
+					gif := localGif{Name: name, Size: stat.Size()}
+					if gif.Hash, err = contentHash(path); err != nil {
+						return xerrors.Errorf("hash %s: %w", name, err)
+					}
+					if *similar {
+						if gif.Frames, err = frameHashes(gCtx, path); err != nil {
+							a.log.Warn("Failed to hash frames", zap.String("name", name), zap.Error(err))
+							continue
+						}
+					}
+
+					mux.Lock()
+					gifs = append(gifs, gif)
+					mux.Unlock()
+				}
+				return nil
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+
+		// Largest file of group is likely best quality one, so keeping it.
+		sort.Slice(gifs, func(i, j int) bool {
+			if gifs[i].Size != gifs[j].Size {
+				return gifs[i].Size > gifs[j].Size
+			}
+			return gifs[i].Name < gifs[j].Name
+		})
+		maxDistance := -1
+		if *similar {
+			maxDistance = *distance
+		}
+
+		dups := 0
+		for _, group := range groupLocal(gifs, maxDistance) {
+			if len(group) < 2 {
+				continue
+			}
+			fmt.Print(trf("%s (kept)\n", group[0].Name))
+			for _, d := range group[1:] {
+				reason := tr("same content")
+				if d.Hash != group[0].Hash {
+					reason = trf("similar, distance %d", hashDistance(d.Frames, group[0].Frames))
+				}
+				fmt.Printf("  %s (%s)\n", d.Name, reason)
+				dups++
+
+				if *dir == "" {
+					continue
+				}
+				if err := quarantine(a.store, filepath.Join(a.opt.Out, d.Name), *dir); err != nil {
+					return xerrors.Errorf("quarantine %s: %w", d.Name, err)
+				}
+			}
+		}
+
+		a.log.Info("Dedupe finished",
+			zap.Int("duplicates", dups),
+			zap.Int("total", len(gifs)),
+		)
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// answerPrompter answers every prompt with Answer or Err.
+type answerPrompter struct {
+	Answer string
+	Err    error
+}
+
+func (p answerPrompter) Prompt(string) (string, error) {
+	return p.Answer, p.Err
+}
+
+func TestDedupeRemote(t *testing.T) {
+	for _, tt := range []struct {
+		Name string
+		// Setup prepares output of app before run.
+		Setup func(t *testing.T, a *app)
+		// Prompt answers prompts if not nil.
+		Prompt prompter
+		// Unsaved reports whether duplicate is unsaved.
+		Unsaved bool
+	}{
+		{
+			Name: "Indexed",
+			Setup: func(t *testing.T, a *app) {
+				if err := os.MkdirAll(a.opt.Out, 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(a.opt.Out, "1.mp4"), testContent(1), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				// Same content downloaded elsewhere.
+				name := filepath.Join(t.TempDir(), "2.mp4")
+				if err := os.WriteFile(name, testContent(1), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if err := a.index.Add(a.store, "", indexEntry{ID: 2, Path: name, Size: int64(len(testContent(1)))}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			Unsaved: true,
+		},
+		{
+			Name:   "MetadataNotInteractive",
+			Prompt: answerPrompter{Err: io.EOF},
+		},
+		{
+			Name:    "MetadataConfirmed",
+			Prompt:  answerPrompter{Answer: "y"},
+			Unsaved: true,
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			m := newMockInvoker()
+			mockSavedGifs(m, testGif(1, 320, 240), testGif(2, 320, 240))
+			var unsaved []int64
+			m.On(tg.MessagesSaveGifRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+				r := req.(*tg.MessagesSaveGifRequest)
+				if r.Unsave {
+					unsaved = append(unsaved, r.ID.(*tg.InputDocument).ID)
+				}
+				return &tg.BoolTrue{}, nil
+			})
+			a := newTestApp(t, m)
+			if tt.Prompt != nil {
+				a.prompt = tt.Prompt
+			}
+			if tt.Setup != nil {
+				tt.Setup(t, a)
+			}
+
+			if err := runCommand(context.Background(), a, "dedupe-remote", "--yes", "--interval", "0"); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(unsaved) > 0; got != tt.Unsaved {
+				t.Fatalf("Unsaved %v", unsaved)
+			}
+			if tt.Unsaved && (len(unsaved) != 1 || unsaved[0] != 2) {
+				t.Errorf("Unsaved %v, expected [2]", unsaved)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// readManifest reads entries of manifest written by "list --csv", or of
+// plain text manifest with single ID per line, which has IDs only.
+func readManifest(name string) ([]listEntry, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(string(data), listHeader[0]+",") {
+		ids, err := readManifestIDs(name)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]listEntry, 0, len(ids))
+		for _, id := range ids {
+			entries = append(entries, listEntry{Meta: metadata{ID: id}})
+		}
+		return entries, nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		return nil, xerrors.Errorf("csv: %w", err)
+	}
+	// Columns are looked up by header, so manifests of older versions
+	// without some columns can be read.
+	columns := map[string]int{}
+	for i, c := range records[0] {
+		columns[c] = i
+	}
+	field := func(r []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(r) {
+			return r[i]
+		}
+		return ""
+	}
+
+	entries := make([]listEntry, 0, len(records)-1)
+	for _, r := range records[1:] {
+		var e listEntry
+		if e.Meta.ID, err = strconv.ParseInt(field(r, "id"), 10, 64); err != nil {
+			return nil, xerrors.Errorf("invalid id %q", field(r, "id"))
+		}
+		e.Meta.Date, _ = time.Parse(time.RFC3339, field(r, "date"))
+		e.Meta.Size, _ = strconv.Atoi(field(r, "size"))
+		e.Meta.Duration, _ = strconv.ParseFloat(field(r, "duration"), 64)
+		e.Meta.Width, _ = strconv.Atoi(field(r, "width"))
+		e.Meta.Height, _ = strconv.Atoi(field(r, "height"))
+		e.Meta.MIME = field(r, "mime")
+		e.Meta.Color = field(r, "color")
+		e.Path = field(r, "path")
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// localEntries returns entries of gifs downloaded to dir, identified by
+// sidecar or by name.
+func localEntries(dir string) ([]listEntry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("dir: %w", err)
+	}
+
+	var entries []listEntry
+	for _, f := range files {
+		if f.IsDir() || path.Ext(f.Name()) != ".mp4" {
+			continue
+		}
+		name := filepath.Join(dir, f.Name())
+		m, err := readSidecar(name)
+		if err != nil {
+			if id, ok := readXattrID(name); ok {
+				m.ID = id
+			} else if m.ID, err = strconv.ParseInt(strings.TrimSuffix(f.Name(), ".mp4"), 10, 64); err != nil {
+				// Not downloaded gif.
+				continue
+			}
+		}
+		if info, err := f.Info(); err == nil {
+			m.Size = int(info.Size())
+		}
+		if m.Duration == 0 || m.Width == 0 {
+			if info, err := probeMP4(name); err == nil {
+				m.Duration = info.Duration
+				m.Width, m.Height = info.Width, info.Height
+			}
+		}
+		entries = append(entries, listEntry{Meta: m, Path: name})
+	}
+	return entries, nil
+}
+
+// entryChanges returns human-readable changes of fields known in both
+// entries.
+func entryChanges(before, after metadata) []string {
+	var changes []string
+	ints := []struct {
+		name          string
+		before, after int
+	}{
+		{"size", before.Size, after.Size},
+		{"width", before.Width, after.Width},
+		{"height", before.Height, after.Height},
+	}
+	for _, f := range ints {
+		if f.before != 0 && f.after != 0 && f.before != f.after {
+			changes = append(changes, fmt.Sprintf("%s %d -> %d", f.name, f.before, f.after))
+		}
+	}
+	// API reports duration in whole seconds.
+	if before.Duration != 0 && after.Duration != 0 && math.Abs(before.Duration-after.Duration) >= 1 {
+		changes = append(changes, fmt.Sprintf("duration %gs -> %gs", before.Duration, after.Duration))
+	}
+	if before.Color != "" && after.Color != "" && before.Color != after.Color {
+		changes = append(changes, fmt.Sprintf("color %s -> %s", before.Color, after.Color))
+	}
+	return changes
+}
+
+// writeDiff writes added ("+"), removed ("-") and changed ("~") entries of
+// after compared to before, ordered by ID, returning count of differences.
+func writeDiff(w io.Writer, before, after []listEntry) int {
+	type pair struct {
+		before, after *listEntry
+	}
+	pairs := map[int64]*pair{}
+	get := func(id int64) *pair {
+		p, ok := pairs[id]
+		if !ok {
+			p = &pair{}
+			pairs[id] = p
+		}
+		return p
+	}
+	for i := range before {
+		get(before[i].Meta.ID).before = &before[i]
+	}
+	for i := range after {
+		get(after[i].Meta.ID).after = &after[i]
+	}
+	ids := make([]int64, 0, len(pairs))
+	for id := range pairs {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	diffs := 0
+	for _, id := range ids {
+		p := pairs[id]
+		switch {
+		case p.before == nil:
+			_, _ = fmt.Fprintf(w, "+ %d\n", id)
+		case p.after == nil:
+			_, _ = fmt.Fprintf(w, "- %d\n", id)
+		default:
+			changes := entryChanges(p.before.Meta, p.after.Meta)
+			if len(changes) == 0 {
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "~ %d %s\n", id, strings.Join(changes, ", "))
+		}
+		diffs++
+	}
+	return diffs
+}
+
+// diffOnline reports whether diff with positional args compares with live
+// account.
+func diffOnline(args []string) bool {
+	return len(args) == 0
+}
+
+// diffCmd compares two manifests, manifest with output directory, or output
+// directory with saved gifs of account.
+func diffCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	return func(ctx context.Context, a *app) error {
+		var (
+			before, after []listEntry
+			err           error
+		)
+		switch fs.NArg() {
+		case 2:
+			if before, err = readManifest(fs.Arg(0)); err != nil {
+				return xerrors.Errorf("manifest: %w", err)
+			}
+			if after, err = readManifest(fs.Arg(1)); err != nil {
+				return xerrors.Errorf("manifest: %w", err)
+			}
+		case 1:
+			if before, err = readManifest(fs.Arg(0)); err != nil {
+				return xerrors.Errorf("manifest: %w", err)
+			}
+			if after, err = localEntries(a.opt.Out); err != nil {
+				return err
+			}
+		case 0:
+			if before, err = localEntries(a.opt.Out); err != nil {
+				return err
+			}
+			if after, err = a.savedGifsList(ctx); err != nil {
+				return err
+			}
+		default:
+			return xerrors.New("usage: diff [<manifest> [<other manifest>]]")
+		}
+
+		diffs := writeDiff(os.Stdout, before, after)
+		a.log.Info("Compared", zap.Int("before", len(before)), zap.Int("after", len(after)), zap.Int("differences", diffs))
+		return nil
+	}
+}
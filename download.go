@@ -0,0 +1,549 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/telegram/query/hasher"
+	"github.com/gotd/td/tg"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+// file is a single file to download.
+type file struct {
+	// Name is file path relative to output directory.
+	Name string
+	// Location of file contents.
+	Location tg.InputFileLocationClass
+	// Meta describes file.
+	Meta metadata
+	// Sidecar enables writing Meta to JSON sidecar near file.
+	Sidecar bool
+	// Doc is source document, if file is document.
+	Doc *tg.Document
+	// API is client of account file belongs to, app client is used if nil.
+	API *tg.Client
+	// Refresh updates expired file reference, if not nil.
+	Refresh refresher
+}
+
+// documentFile returns file for document named by its ID.
+func documentFile(dir, source string, doc *tg.Document) file {
+	return file{
+		Name:     filepath.Join(dir, fmt.Sprintf("%d%s", doc.ID, documentExt(doc))),
+		Location: doc.AsInputDocumentFileLocation(),
+		Meta:     documentMetadata(source, doc),
+		Doc:      doc,
+	}
+}
+
+// photoFile returns file for largest size of photo named by its ID.
+func photoFile(dir, source string, photo *tg.Photo) (file, bool) {
+	var (
+		thumb string
+		w, h  int
+	)
+	for _, size := range photo.Sizes {
+		var (
+			t            string
+			sizeW, sizeH int
+		)
+		switch size := size.(type) {
+		case *tg.PhotoSize:
+			t, sizeW, sizeH = size.Type, size.W, size.H
+		case *tg.PhotoSizeProgressive:
+			t, sizeW, sizeH = size.Type, size.W, size.H
+		default:
+			// Stripped and cached sizes are inlined previews.
+			continue
+		}
+		if sizeW*sizeH > w*h {
+			thumb, w, h = t, sizeW, sizeH
+		}
+	}
+	if thumb == "" {
+		return file{}, false
+	}
+
+	loc := photo.AsInputPhotoFileLocation()
+	loc.ThumbSize = thumb
+	return file{
+		Name:     filepath.Join(dir, fmt.Sprintf("%d.jpg", photo.ID)),
+		Location: loc,
+		Meta: metadata{
+			ID:     photo.ID,
+			Date:   time.Unix(int64(photo.Date), 0),
+			Source: source,
+			MIME:   "image/jpeg",
+			Width:  w,
+			Height: h,
+		},
+	}, true
+}
+
+// fileAPI returns client to download f with.
+func (a *app) fileAPI(f file) *tg.Client {
+	if f.API != nil {
+		return f.API
+	}
+	return a.api
+}
+
+// send sends f to files, unless context is done.
+func send(ctx context.Context, files chan<- file, f file) error {
+	select {
+	case files <- f:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// source sends files to download.
+type source func(ctx context.Context, files chan<- file) error
+
+// pipeline describes download of files from single source.
+type pipeline struct {
+	// Source sends all files to download.
+	Source source
+	// Done is optional callback called after file is downloaded.
+	Done func(ctx context.Context, f file) error
+	// Op is journaled operation performed by Done, if any, so it is
+	// completed on next run if interrupted.
+	Op string
+}
+
+// download runs pipeline, downloading files to output directory concurrently.
+func (a *app) download(ctx context.Context, p pipeline) error {
+	log := a.log
+	parent := ctx
+
+	src := p.Source
+	if !a.filter.Empty() {
+		src = a.filter.filtered(src)
+	}
+
+	files := make(chan file, a.opt.Jobs)
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		defer close(files)
+		return src(ctx, files)
+	})
+
+	// Downloaded videos are passed to post-processing workers, if any
+	// processing is requested.
+	var processed chan file
+	if a.postprocessing() {
+		processed = make(chan file, a.opt.ConvertJobs)
+		for j := 0; j < a.opt.ConvertJobs; j++ {
+			g.Go(func() error {
+				for f := range processed {
+					if err := a.postprocess(ctx, f); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+	}
+
+	var (
+		total      atomic.Int32
+		downloaded atomic.Int32
+		corrupt    atomic.Int32
+		failed     atomic.Int32
+		workers    sync.WaitGroup
+
+		brokenMux sync.Mutex
+		broken    []int64
+	)
+	// skipBroken reports broken document of f, which is skipped.
+	skipBroken := func(f file, reason string) {
+		log.Warn("Skipping broken document",
+			zap.Int64("id", f.Meta.ID),
+			zap.String("path", f.Name),
+			zap.String("reason", reason),
+		)
+		brokenMux.Lock()
+		broken = append(broken, f.Meta.ID)
+		brokenMux.Unlock()
+	}
+	for j := 0; j < a.opt.Jobs; j++ {
+		workers.Add(1)
+		g.Go(func() error {
+			defer workers.Done()
+			// Process all discovered files.
+			d := downloader.NewDownloader()
+			for f := range files {
+				total.Inc()
+				name, overwrite, err := a.names.claim(a.opt.Out, f)
+				if err != nil {
+					return xerrors.Errorf("name: %w", err)
+				}
+				f.Name = name
+				filePath := filepath.Join(a.opt.Out, f.Name)
+				log.Info("Got file",
+					zap.Int64("id", f.Meta.ID),
+					zap.Time("date", f.Meta.Date),
+					zap.String("path", filePath),
+				)
+
+				profile := a.profileOf(a.fileAPI(f))
+				if overwrite {
+					log.Warn("Overwriting file of other document", zap.String("path", filePath))
+					if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+						return xerrors.Errorf("remove: %w", err)
+					}
+				} else if a.downloaded(filePath) {
+					// File exists, skipping.
+					//
+					// Note that we are not completely sure that existing
+					// file is exactly same as this one (e.g. partial
+					// download), so not calling Done.
+					a.indexExisting(profile, f, filePath)
+					continue
+				} else if ok, err := a.downloadedElsewhere(profile, f, filePath); err != nil {
+					return err
+				} else if ok {
+					continue
+				}
+				if reason := brokenReason(f); reason != "" {
+					skipBroken(f, reason)
+					continue
+				}
+				if err := a.store.MkdirAll(filepath.Dir(filePath), 0o750); err != nil {
+					return xerrors.Errorf("mkdir: %w", err)
+				}
+
+				if err := a.waitTransfer(ctx, profile); err != nil {
+					return err
+				}
+
+				// Downloading to partial file first, so interrupted download
+				// is not skipped as complete one on next run.
+				part := a.store.TempName(filePath, ".part")
+				reason, err := a.fetch(ctx, d, &f, part)
+				if reason != "" {
+					if err := os.Remove(part); err != nil && !os.IsNotExist(err) {
+						return xerrors.Errorf("remove: %w", err)
+					}
+					skipBroken(f, reason)
+					continue
+				}
+				if err != nil {
+					_ = os.Remove(part)
+					if ctx.Err() != nil {
+						return ctx.Err()
+					}
+					// Failing only this document, not whole queue.
+					log.Error("Failed to download",
+						zap.Int64("id", f.Meta.ID),
+						zap.String("path", filePath),
+						zap.Error(err),
+					)
+					failed.Inc()
+					continue
+				}
+				if err := a.store.Replace(part, filePath); err != nil {
+					return err
+				}
+				a.indexFile(profile, f, filePath)
+				if stat, err := os.Stat(filePath); err == nil {
+					a.addTransfer(profile, stat.Size())
+				}
+				if f.Meta.MIME == "video/mp4" && a.opt.Validate {
+					if err := validateMP4(ctx, filePath); err != nil {
+						// Removing, so next run downloads file again, and
+						// not calling Done, e.g. to keep corrupt gif saved.
+						log.Warn("Downloaded file is corrupt",
+							zap.String("path", filePath),
+							zap.Error(err),
+						)
+						corrupt.Inc()
+						if err := os.Remove(filePath); err != nil {
+							return xerrors.Errorf("remove: %w", err)
+						}
+						continue
+					}
+				}
+				var seq int64
+				if p.Op != "" && f.Doc != nil {
+					acc, _ := a.accountOf(f)
+					if seq, err = a.journal.Begin(journalEntry{
+						Op:            p.Op,
+						Profile:       acc.Profile,
+						DocID:         f.Doc.ID,
+						AccessHash:    f.Doc.AccessHash,
+						FileReference: f.Doc.FileReference,
+						Name:          filePath,
+					}); err != nil {
+						return xerrors.Errorf("journal: %w", err)
+					}
+				}
+				if f.Meta.MIME == "video/mp4" && (f.Meta.Duration == 0 || f.Meta.Width == 0) {
+					// Filling attributes missing in document from file.
+					if info, err := probeMP4(filePath); err == nil {
+						f.Meta.Duration = info.Duration
+						f.Meta.Width, f.Meta.Height = info.Width, info.Height
+					}
+				}
+				if f.Meta.Color == "" && f.Sidecar && a.opt.FrameColor &&
+					strings.HasPrefix(f.Meta.MIME, "video/") {
+					// Documents without inlined thumbnail.
+					if c, err := frameColor(ctx, filePath); err == nil {
+						f.Meta.Color = c
+					}
+				}
+				if f.Sidecar {
+					if err := writeSidecar(a.store, filePath, f.Meta); err != nil {
+						return xerrors.Errorf("sidecar: %w", err)
+					}
+				}
+				if a.opt.XMP {
+					if err := writeXMP(a.store, filePath, f.Meta); err != nil {
+						return xerrors.Errorf("xmp: %w", err)
+					}
+				}
+				if a.opt.Xattr {
+					if err := writeXattrs(filePath, f); err != nil {
+						// E.g. filesystem without extended attributes.
+						log.Warn("Failed to write extended attributes", zap.String("path", filePath), zap.Error(err))
+					}
+				}
+				downloaded.Inc()
+				if err := a.checkpoint.Add(f.Name); err != nil {
+					return xerrors.Errorf("checkpoint: %w", err)
+				}
+
+				if p.Done != nil {
+					if err := p.Done(ctx, f); err != nil {
+						return err
+					}
+				}
+				if seq != 0 {
+					if err := a.journal.Commit(seq); err != nil {
+						return xerrors.Errorf("journal: %w", err)
+					}
+				}
+				if processed != nil && a.convertible(f) {
+					select {
+					case processed <- f:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+			}
+
+			return nil
+		})
+	}
+	if processed != nil {
+		g.Go(func() error {
+			workers.Wait()
+			close(processed)
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		if parent.Err() != nil {
+			// Skipping of downloaded files on next run resumes download.
+			return &interruptedError{
+				Completed: int(downloaded.Load()),
+				Total:     int(total.Load()),
+			}
+		}
+		return err
+	}
+	log.Info("Finished",
+		zap.Int32("downloaded", downloaded.Load()),
+		zap.Int32("corrupt", corrupt.Load()),
+		zap.Int("broken", len(broken)),
+		zap.Int32("failed", failed.Load()),
+		zap.Int32("total", total.Load()),
+	)
+	if len(broken) > 0 {
+		log.Warn("Broken documents were skipped", zap.Int64s("ids", broken))
+	}
+	if n := failed.Load(); n > 0 {
+		return xerrors.Errorf("failed to download %d files", n)
+	}
+
+	return nil
+}
+
+// savedGifs returns source of all saved gifs of account, stored in dir.
+func (a *app) savedGifs(api *tg.Client, dir string) source {
+	return func(ctx context.Context, files chan<- file) error {
+		// Telegram allows up to 200 saved gifs, but only hides exceeding
+		// ones.
+		//
+		// Hasher implements Telegram "pagination" hash calculation and
+		// allows us exhaust all gifs in "rm" mode.
+		h := hasher.Hasher{}
+		for {
+			result, err := api.MessagesGetSavedGifs(ctx, int(h.Sum()))
+			if err != nil {
+				return xerrors.Errorf("get: %w", err)
+			}
+
+			h.Reset()
+			switch result := result.(type) {
+			case *tg.MessagesSavedGifsNotModified:
+				// Done.
+				return nil
+			case *tg.MessagesSavedGifs:
+				a.log.Info("Got gifs",
+					zap.Int("count", len(result.Gifs)),
+				)
+				if len(result.Gifs) == 0 {
+					// No results.
+					return nil
+				}
+
+				// Processing batch.
+				for _, doc := range result.Gifs {
+					doc, ok := doc.AsNotEmpty()
+					if !ok {
+						continue
+					}
+
+					// Saved gifs are always stored as "<id>.mp4".
+					f := documentFile(dir, "gifs", doc)
+					f.Name = filepath.Join(dir, fmt.Sprintf("%d.mp4", doc.ID))
+					f.API = api
+					f.Refresh = savedGifRefresher(api)
+					if err := send(ctx, files, f); err != nil {
+						return err
+					}
+					h.Update64(uint64(doc.ID))
+				}
+			}
+		}
+	}
+}
+
+// listSavedGifs returns all saved gifs, most recently saved first.
+func listSavedGifs(ctx context.Context, api *tg.Client) ([]*tg.Document, error) {
+	result, err := api.MessagesGetSavedGifs(ctx, 0)
+	if err != nil {
+		return nil, xerrors.Errorf("get: %w", err)
+	}
+	saved, ok := result.(*tg.MessagesSavedGifs)
+	if !ok {
+		return nil, nil
+	}
+
+	docs := make([]*tg.Document, 0, len(saved.Gifs))
+	for _, doc := range saved.Gifs {
+		doc, ok := doc.AsNotEmpty()
+		if !ok {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// saveGif saves document to saved gifs or removes it from there.
+//
+// Saving already saved gif moves it to the top of saved gifs.
+func saveGif(ctx context.Context, api *tg.Client, doc *tg.Document, unsave bool) error {
+	_, err := api.MessagesSaveGif(ctx, &tg.MessagesSaveGifRequest{
+		ID:     doc.AsInput(),
+		Unsave: unsave,
+	})
+	return err
+}
+
+// downloadCmd downloads all saved gifs to output directory, uploading gifs
+// from input directory first if requested.
+//
+// With multiple profiles gifs of each one are stored in subdirectory named
+// by profile, unless merge is requested.
+func downloadCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	merge := fs.Bool("merge", false, "merge saved gifs of all profiles into output directory, skipping duplicates")
+	return func(ctx context.Context, a *app) error {
+		j, err := a.openJournal(ctx)
+		if err != nil {
+			return xerrors.Errorf("journal: %w", err)
+		}
+		a.journal = j
+
+		if a.opt.Input != "" {
+			if len(a.accounts) > 1 {
+				return xerrors.New("upload is not supported with multiple profiles")
+			}
+			// Handling bulk upload.
+			// Probably we can de-duplicate gifs by some criteria.
+			if err := upload(ctx, a.log, a.accounts[0].Invoker, a.opt.Input, uploadOptions{
+				Store:     a.store,
+				Validate:  a.opt.Validate,
+				Watermark: a.opt.Watermark,
+				Position:  a.opt.WatermarkPosition,
+				Journal:   j,
+				Wait: func(ctx context.Context) error {
+					return a.waitTransfer(ctx, a.accounts[0].Profile)
+				},
+				Transferred: func(n int64) {
+					a.addTransfer(a.accounts[0].Profile, n)
+				},
+			}); err != nil {
+				return xerrors.Errorf("upload: %w", err)
+			}
+		}
+
+		var p pipeline
+		switch {
+		case len(a.accounts) == 1:
+			p.Source = a.savedGifs(a.api, "")
+		case *merge:
+			m, err := a.newMerge(ctx)
+			if err != nil {
+				return xerrors.Errorf("merge: %w", err)
+			}
+			p.Source = m.Source
+			p.Done = m.Done
+		default:
+			p.Source = func(ctx context.Context, files chan<- file) error {
+				for _, acc := range a.accounts {
+					if err := a.savedGifs(acc.API, acc.Profile)(ctx, files); err != nil {
+						return xerrors.Errorf("profile %q: %w", acc.Profile, err)
+					}
+				}
+				return nil
+			}
+		}
+		if a.opt.Remove {
+			p.Op = journalRemove
+			done := p.Done
+			p.Done = func(ctx context.Context, f file) error {
+				if done != nil {
+					if err := done(ctx, f); err != nil {
+						return err
+					}
+				}
+				a.log.Info("Removing gif after download",
+					zap.Int64("id", f.Doc.ID),
+					zap.Time("date", f.Meta.Date),
+				)
+				if err := saveGif(ctx, a.fileAPI(f), f.Doc, true); err != nil {
+					return xerrors.Errorf("remove: %w", err)
+				}
+				return nil
+			}
+		}
+
+		return a.download(ctx, p)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// testGif returns saved gif document with video attribute of size.
+func testGif(id int64, w, h int) *tg.Document {
+	return &tg.Document{
+		ID:         id,
+		AccessHash: id,
+		MimeType:   "video/mp4",
+		Size:       len(testContent(id)),
+		Attributes: []tg.DocumentAttributeClass{
+			&tg.DocumentAttributeAnimated{},
+			&tg.DocumentAttributeVideo{Duration: 1, W: w, H: h},
+		},
+	}
+}
+
+// testContent returns contents of document.
+func testContent(id int64) []byte {
+	return []byte(fmt.Sprintf("contents of document %d", id))
+}
+
+// mockSavedGifs sets handlers of saved gifs and their contents, returning
+// function listing IDs of fetched documents.
+func mockSavedGifs(m *mockInvoker, docs ...*tg.Document) func() []int64 {
+	gifs := make([]tg.DocumentClass, 0, len(docs))
+	for _, doc := range docs {
+		gifs = append(gifs, doc)
+	}
+	m.On(tg.MessagesGetSavedGifsRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+		if req.(*tg.MessagesGetSavedGifsRequest).Hash != 0 {
+			return &tg.MessagesSavedGifsNotModified{}, nil
+		}
+		return &tg.MessagesSavedGifs{Gifs: gifs}, nil
+	})
+
+	var (
+		mux     sync.Mutex
+		fetched []int64
+	)
+	m.On(tg.UploadGetFileRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+		r := req.(*tg.UploadGetFileRequest)
+		loc := r.Location.(*tg.InputDocumentFileLocation)
+		data := testContent(loc.ID)
+		if r.Offset >= len(data) {
+			return &tg.UploadFile{Type: &tg.StorageFileMp4{}}, nil
+		}
+		mux.Lock()
+		fetched = append(fetched, loc.ID)
+		mux.Unlock()
+		return &tg.UploadFile{Type: &tg.StorageFileMp4{}, Bytes: data[r.Offset:]}, nil
+	})
+	return func() []int64 {
+		mux.Lock()
+		defer mux.Unlock()
+		return append([]int64(nil), fetched...)
+	}
+}
+
+func TestDownloadSkip(t *testing.T) {
+	for _, tt := range []struct {
+		Name string
+		Doc  *tg.Document
+		Args []string
+		// Setup prepares output of app before run.
+		Setup func(t *testing.T, a *app)
+		// Fetched reports whether document is downloaded.
+		Fetched bool
+	}{
+		{
+			Name:    "New",
+			Doc:     testGif(1, 320, 240),
+			Fetched: true,
+		},
+		{
+			Name: "Existing",
+			Doc:  testGif(1, 320, 240),
+			Setup: func(t *testing.T, a *app) {
+				if err := os.MkdirAll(a.opt.Out, 0o750); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(a.opt.Out, "1.mp4"), testContent(1), 0o600); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			Name: "DownloadedElsewhere",
+			Doc:  testGif(1, 320, 240),
+			Setup: func(t *testing.T, a *app) {
+				name := filepath.Join(t.TempDir(), "1.mp4")
+				if err := os.WriteFile(name, testContent(1), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if err := a.index.Add(a.store, "", indexEntry{ID: 1, Path: name, Size: int64(len(testContent(1)))}); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+		{
+			Name: "ChangedElsewhere",
+			Doc:  testGif(1, 320, 240),
+			Setup: func(t *testing.T, a *app) {
+				name := filepath.Join(t.TempDir(), "1.mp4")
+				if err := os.WriteFile(name, []byte("other"), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				if err := a.index.Add(a.store, "", indexEntry{ID: 1, Path: name, Size: int64(len(testContent(1)))}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			Fetched: true,
+		},
+		{
+			Name: "Filtered",
+			Doc:  testGif(1, 320, 240),
+			Args: []string{"--min-resolution", "720p"},
+		},
+		{
+			Name: "ZeroSize",
+			Doc: func() *tg.Document {
+				doc := testGif(1, 320, 240)
+				doc.Size = 0
+				return doc
+			}(),
+		},
+		{
+			Name: "NoVideoAttribute",
+			Doc: func() *tg.Document {
+				doc := testGif(1, 320, 240)
+				doc.Attributes = doc.Attributes[:1]
+				return doc
+			}(),
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			m := newMockInvoker()
+			fetched := mockSavedGifs(m, tt.Doc)
+			a := newTestApp(t, m)
+			if tt.Setup != nil {
+				tt.Setup(t, a)
+			}
+
+			if err := runCommand(context.Background(), a, "download", tt.Args...); err != nil {
+				t.Fatal(err)
+			}
+			if got := len(fetched()) > 0; got != tt.Fetched {
+				t.Fatalf("Fetched %v, expected %v", got, tt.Fetched)
+			}
+			if !tt.Fetched {
+				return
+			}
+			data, err := os.ReadFile(filepath.Join(a.opt.Out, "1.mp4"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != string(testContent(1)) {
+				t.Errorf("Got contents %q", data)
+			}
+		})
+	}
+}
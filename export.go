@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+// platform is a preset of rendition constraints.
+type platform struct {
+	MaxSize  byteSize
+	MaxWidth int
+}
+
+var platforms = map[string]platform{
+	"discord":     {MaxSize: 8 << 20},
+	"slack-emoji": {MaxSize: 128 << 10, MaxWidth: 128},
+}
+
+// exportLadder is list of rendition parameters tried in order until result
+// fits into size limit, from best quality to smallest file.
+var exportLadder = []rendition{
+	{},
+	{Width: 480, FPS: 15},
+	{Width: 320, FPS: 12},
+	{Width: 240, FPS: 10},
+	{Width: 160, FPS: 8},
+	{Width: 128, FPS: 8},
+	{Width: 96, FPS: 6},
+}
+
+// exportCmd converts downloaded mp4 files to GIF or WebP renditions that fit
+// into platform limits, leaving originals untouched.
+func exportCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		maxSize byteSize
+		format  = fs.String("format", "gif", "rendition format (gif, webp, apng)")
+		preset  = fs.String("platform", "", "platform preset (discord, slack-emoji)")
+		dir     = fs.String("dir", "", "rendition directory (default is \"export\" in output directory)")
+	)
+	fs.Var(&maxSize, "max-size", "maximum rendition size, e.g. 8MB (zero is unlimited)")
+
+	return func(ctx context.Context, a *app) error {
+		if !hasFFmpeg() {
+			return errNoFFmpeg
+		}
+		log := a.log
+
+		maxWidth := 0
+		if *preset != "" {
+			p, ok := platforms[*preset]
+			if !ok {
+				return xerrors.Errorf("unknown platform %q", *preset)
+			}
+			if maxSize == 0 || p.MaxSize < maxSize {
+				maxSize = p.MaxSize
+			}
+			maxWidth = p.MaxWidth
+		}
+		if *format != "gif" && *format != "webp" && *format != "apng" {
+			return xerrors.Errorf("unsupported format %q", *format)
+		}
+		if *dir == "" {
+			*dir = filepath.Join(a.opt.Out, "export")
+		}
+		if err := a.store.MkdirAll(*dir, 0o750); err != nil {
+			return xerrors.Errorf("mkdir: %w", err)
+		}
+
+		entries, err := os.ReadDir(a.opt.Out)
+		if err != nil {
+			return xerrors.Errorf("dir: %w", err)
+		}
+
+		names := make(chan string, a.opt.Jobs)
+		g, ctx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			defer close(names)
+			for _, e := range entries {
+				if e.IsDir() || path.Ext(e.Name()) != ".mp4" {
+					continue
+				}
+				select {
+				case names <- e.Name():
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+
+		var exported, oversized atomic.Int32
+		for j := 0; j < a.opt.Jobs; j++ {
+			g.Go(func() error {
+				for name := range names {
+					in := filepath.Join(a.opt.Out, name)
+					out := filepath.Join(*dir, strings.TrimSuffix(name, ".mp4")+rendition{Format: *format}.ext())
+					if _, err := os.Stat(out); err == nil {
+						// Already exported.
+						continue
+					}
+
+					ok, err := exportFile(ctx, log, a.store, in, out, *format, maxSize, maxWidth)
+					if err != nil {
+						return xerrors.Errorf("export %s: %w", name, err)
+					}
+					if !ok {
+						oversized.Inc()
+						continue
+					}
+					exported.Inc()
+				}
+				return nil
+			})
+		}
+
+		if err := g.Wait(); err != nil {
+			return err
+		}
+		log.Info("Export finished",
+			zap.Int32("exported", exported.Load()),
+			zap.Int32("oversized", oversized.Load()),
+			zap.String("dir", *dir),
+		)
+
+		return nil
+	}
+}
+
+// exportFile renders in to out walking exportLadder until rendition fits
+// into maxSize, reporting false if no rendition fits.
+func exportFile(ctx context.Context, log *zap.Logger, store storage, in, out, format string, maxSize byteSize, maxWidth int) (bool, error) {
+	var prev rendition
+	for i, r := range exportLadder {
+		if maxWidth > 0 && (r.Width == 0 || r.Width > maxWidth) {
+			r.Width = maxWidth
+		}
+		r.Format = format
+		if i > 0 && prev == r {
+			// Clamped to same parameters as previous attempt.
+			continue
+		}
+		prev = r
+
+		if err := convert(ctx, store, r, in, out); err != nil {
+			return false, err
+		}
+		stat, err := os.Stat(out)
+		if err != nil {
+			return false, err
+		}
+		if maxSize == 0 || byteSize(stat.Size()) <= maxSize {
+			log.Info("Exported",
+				zap.String("path", out),
+				zap.Stringer("rendition", r),
+				zap.Int64("size", stat.Size()),
+			)
+			return true, nil
+		}
+		if err := os.Remove(out); err != nil {
+			return false, err
+		}
+	}
+
+	log.Warn("No rendition fits size limit",
+		zap.String("path", in),
+		zap.Stringer("max_size", maxSize),
+	)
+	return false, nil
+}
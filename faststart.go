@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// errFaststartLayout is returned by moveMoov for layouts it can't handle.
+var errFaststartLayout = xerrors.New("unsupported layout")
+
+// shiftChunkOffsets adds delta to chunk offsets in stco and co64 boxes of
+// moov payload, which is modified in place.
+func shiftChunkOffsets(moov []byte, delta int64) error {
+	r := bytes.NewReader(moov)
+	var walk func(offset, end int64) error
+	walk = func(offset, end int64) error {
+		boxes, err := mp4Boxes(r, offset, end)
+		if err != nil {
+			return err
+		}
+		for _, b := range boxes {
+			p := moov[b.Offset : b.Offset+b.Size]
+			switch b.Type {
+			case "trak", "mdia", "minf", "stbl":
+				if err := walk(b.Offset, b.Offset+b.Size); err != nil {
+					return err
+				}
+			case "stco", "co64":
+				if len(p) < 8 {
+					return xerrors.Errorf("invalid %s", b.Type)
+				}
+				size := 4
+				if b.Type == "co64" {
+					size = 8
+				}
+				n := int(binary.BigEndian.Uint32(p[4:8]))
+				if len(p) < 8+n*size {
+					return xerrors.Errorf("invalid %s", b.Type)
+				}
+				for i := 0; i < n; i++ {
+					e := p[8+i*size:]
+					if size == 8 {
+						binary.BigEndian.PutUint64(e, uint64(int64(binary.BigEndian.Uint64(e))+delta))
+						continue
+					}
+					v := int64(binary.BigEndian.Uint32(e)) + delta
+					if v > math.MaxUint32 {
+						// Would require upgrading stco to co64.
+						return errFaststartLayout
+					}
+					binary.BigEndian.PutUint32(e, uint32(v))
+				}
+			}
+		}
+		return nil
+	}
+	return walk(0, int64(len(moov)))
+}
+
+// moveMoov writes mp4 from f to w with moov box moved before first mdat.
+//
+// Only files with moov after all media data are handled, which is layout
+// of most encoders without faststart.
+func moveMoov(f *os.File, boxes []mp4Box, w io.Writer) error {
+	firstData, moovIdx := -1, -1
+	for i, b := range boxes {
+		switch b.Type {
+		case "mdat":
+			if firstData < 0 {
+				firstData = i
+			}
+			if moovIdx >= 0 {
+				return errFaststartLayout
+			}
+		case "moov":
+			moovIdx = i
+		}
+	}
+	if moovIdx < 0 || firstData < 0 {
+		return errFaststartLayout
+	}
+
+	// Reading whole moov with header, as it is written as is.
+	moov := boxes[moovIdx]
+	start := boxStart(boxes, moovIdx)
+	raw := make([]byte, moov.Offset+moov.Size-start)
+	if _, err := f.ReadAt(raw, start); err != nil {
+		return err
+	}
+	if binary.BigEndian.Uint32(raw[:4]) == 0 {
+		// Size of box extending to end of file is not valid elsewhere.
+		return errFaststartLayout
+	}
+	if err := shiftChunkOffsets(raw[moov.Offset-start:], int64(len(raw))); err != nil {
+		return err
+	}
+
+	copyBox := func(i int) error {
+		start := boxStart(boxes, i)
+		_, err := io.Copy(w, io.NewSectionReader(f, start, boxes[i].Offset+boxes[i].Size-start))
+		return err
+	}
+	for i := range boxes {
+		if i == firstData {
+			if _, err := w.Write(raw); err != nil {
+				return err
+			}
+		}
+		if i == moovIdx {
+			continue
+		}
+		if err := copyBox(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boxStart returns offset of i-th box header, i.e. end of previous box.
+func boxStart(boxes []mp4Box, i int) int64 {
+	if i == 0 {
+		return 0
+	}
+	return boxes[i-1].Offset + boxes[i-1].Size
+}
+
+// needsFaststart reports whether moov box of mp4 is after media data.
+func needsFaststart(boxes []mp4Box) bool {
+	for _, b := range boxes {
+		switch b.Type {
+		case "moov":
+			return false
+		case "mdat":
+			return true
+		}
+	}
+	return false
+}
+
+// faststart returns name of temporary copy of mp4 file at name with moov
+// box moved before media data, so playback can start before whole file is
+// loaded, or name itself if it is already laid out so. File at name is never
+// changed, copy must be removed by caller.
+//
+// Layouts not handled natively are remuxed by ffmpeg, if available.
+func faststart(ctx context.Context, store storage, name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	stat, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	boxes, err := mp4Boxes(f, 0, stat.Size())
+	if err != nil {
+		return "", xerrors.Errorf("boxes: %w", err)
+	}
+	if !needsFaststart(boxes) {
+		return name, nil
+	}
+
+	out, err := os.CreateTemp(store.TempDir(), "telegifdl-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	err = moveMoov(f, boxes, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if xerrors.Is(err, errFaststartLayout) && hasFFmpeg() {
+		err = ffmpeg(ctx, []string{
+			"-hide_banner", "-loglevel", "error", "-y", "-i", name,
+			"-map", "0", "-c", "copy", "-movflags", "+faststart", "-f", "mp4", out.Name(),
+		})
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
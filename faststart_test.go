@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testBox returns mp4 box of type with payload.
+func testBox(typ string, payload ...[]byte) []byte {
+	data := bytes.Join(payload, nil)
+	b := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(b, uint32(8+len(data)))
+	copy(b[4:], typ)
+	return append(b, data...)
+}
+
+// testMoov returns moov box with single chunk at offset.
+func testMoov(offset uint32) []byte {
+	stco := make([]byte, 12)
+	binary.BigEndian.PutUint32(stco[4:], 1)
+	binary.BigEndian.PutUint32(stco[8:], offset)
+	return testBox("moov", testBox("trak", testBox("mdia", testBox("minf", testBox("stbl", testBox("stco", stco))))))
+}
+
+func TestFaststart(t *testing.T) {
+	var (
+		ftyp = testBox("ftyp", []byte("isom"))
+		mdat = testBox("mdat", []byte("data"))
+		// Chunk is payload of mdat following ftyp.
+		moov = testMoov(uint32(len(ftyp) + 8))
+	)
+	store := newDiskStorage()
+	store.Scratch = t.TempDir()
+
+	t.Run("MoovAfterData", func(t *testing.T) {
+		in := bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+		name := filepath.Join(t.TempDir(), "gif.mp4")
+		if err := os.WriteFile(name, in, 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		fast, err := faststart(context.Background(), store, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fast == name {
+			t.Fatal("Input is not remuxed")
+		}
+		defer func() { _ = os.Remove(fast) }()
+		if filepath.Dir(fast) != store.Scratch {
+			t.Errorf("Copy %s is not in scratch directory", fast)
+		}
+		if data, err := os.ReadFile(name); err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(data, in) {
+			t.Error("Input is changed")
+		}
+
+		data, err := os.ReadFile(fast)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := bytes.Join([][]byte{ftyp, testMoov(uint32(len(ftyp) + len(moov) + 8)), mdat}, nil)
+		if !bytes.Equal(data, expected) {
+			t.Errorf("Got %x, expected %x", data, expected)
+		}
+	})
+	t.Run("MoovBeforeData", func(t *testing.T) {
+		name := filepath.Join(t.TempDir(), "gif.mp4")
+		if err := os.WriteFile(name, bytes.Join([][]byte{ftyp, moov, mdat}, nil), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		fast, err := faststart(context.Background(), store, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fast != name {
+			t.Errorf("Got copy %s of file in faststart layout", fast)
+		}
+	})
+}
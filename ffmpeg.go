@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// errNoFFmpeg is returned by operations requiring ffmpeg when it is not
+// available.
+var errNoFFmpeg = xerrors.New("ffmpeg is not found in PATH or not built in, see \"ffmpeg\" build tag")
+
+// rendition describes ffmpeg conversion target.
+type rendition struct {
+	// Format is output format, "gif", "webp", "apng", "webm" or "mp4".
+	Format string
+	// Width of output, zero keeps source width.
+	Width int
+	// FPS of output, zero keeps source frame rate.
+	FPS int
+	// MaxDim limits larger dimension of output, zero is unlimited.
+	MaxDim int
+	// Length limits duration of output, zero keeps whole source.
+	Length time.Duration
+	// Plays is number of times animation is played, zero loops forever.
+	Plays int
+	// Quality is lossy webp quality from 0 to 100, zero means default 75.
+	// For gif it scales palette size, zero means full 256 colors palette.
+	Quality int
+	// CRF is constant rate factor of mp4 and webm, zero means default.
+	CRF int
+	// Encoder is hardware h264 encoder of mp4, empty means libx264.
+	Encoder string
+	// Bitrate is mp4 video bitrate in kbit/s, zero means constant quality.
+	// Non-zero bitrate is encoded in two passes.
+	Bitrate int
+	// Pass is current pass of two-pass encoding, zero for single pass.
+	Pass int
+	// PassLog is prefix of two-pass encoding log files.
+	PassLog string
+}
+
+func (r rendition) String() string {
+	return fmt.Sprintf("%s %dw@%dfps", r.Format, r.Width, r.FPS)
+}
+
+// ext returns output file extension.
+func (r rendition) ext() string {
+	if r.Format == "apng" {
+		// Browsers and viewers recognize APNG by contents, while ".apng"
+		// is rarely supported.
+		return ".png"
+	}
+	return "." + r.Format
+}
+
+// ffmpegOptions returns flags of requested processing requiring ffmpeg.
+func (o options) ffmpegOptions() []string {
+	var flags []string
+	for _, f := range []struct {
+		Name string
+		Set  bool
+	}{
+		{"-convert", o.Convert != ""},
+		{"-posters", o.Posters},
+		{"-provenance", o.Provenance},
+		{"-previews", o.Previews > 0},
+		{"-spritesheet", o.Sprite.Columns > 0},
+		{"-webm-to-mp4", o.WebmToMP4},
+		{"-watermark", o.Watermark != ""},
+		{"-frame-color", o.FrameColor},
+	} {
+		if f.Set {
+			flags = append(flags, f.Name)
+		}
+	}
+	return flags
+}
@@ -0,0 +1,48 @@
+//go:build !ffmpeg
+// +build !ffmpeg
+
+package main
+
+import "context"
+
+// Built without "ffmpeg" tag, so ffmpeg processing is left out and every
+// operation requiring it fails with errNoFFmpeg.
+
+// hasFFmpeg reports whether ffmpeg is in PATH.
+func hasFFmpeg() bool { return false }
+
+func ffmpeg(context.Context, []string) error { return errNoFFmpeg }
+
+func convert(context.Context, storage, rendition, string, string) error { return errNoFFmpeg }
+
+// decodeFrame skips decoding check.
+func decodeFrame(context.Context, string) error { return nil }
+
+func frameColor(context.Context, string) (string, error) { return "", errNoFFmpeg }
+
+func frameHashes(context.Context, string) ([]uint64, error) { return nil, errNoFFmpeg }
+
+// hwEncoder returns software encoder, as hardware ones are used only by
+// ffmpeg.
+func hwEncoder(_ context.Context, mode string) (string, error) {
+	if mode == "" || mode == "none" {
+		return "", nil
+	}
+	return "", errNoFFmpeg
+}
+
+func (a *app) renderPreview(context.Context, file) error { return errNoFFmpeg }
+
+func (a *app) renderSprite(context.Context, file) error { return errNoFFmpeg }
+
+func (a *app) extractPoster(context.Context, file) error { return errNoFFmpeg }
+
+func (a *app) embedProvenance(context.Context, file) error { return errNoFFmpeg }
+
+func (a *app) webmToMP4(context.Context, file) error { return errNoFFmpeg }
+
+func (a *app) compileReel(context.Context, reel) error { return errNoFFmpeg }
+
+func watermark(context.Context, storage, string, string, string) (string, error) {
+	return "", errNoFFmpeg
+}
@@ -0,0 +1,296 @@
+//go:build ffmpeg
+// +build ffmpeg
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+var (
+	ffmpegOnce  sync.Once
+	ffmpegFound bool
+)
+
+// hasFFmpeg reports whether ffmpeg is in PATH.
+func hasFFmpeg() bool {
+	ffmpegOnce.Do(func() {
+		_, err := exec.LookPath("ffmpeg")
+		ffmpegFound = err == nil
+	})
+	return ffmpegFound
+}
+
+// ffmpeg runs ffmpeg from PATH with args.
+func ffmpeg(ctx context.Context, args []string) error {
+	if !hasFFmpeg() {
+		return errNoFFmpeg
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return xerrors.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// maxGIFFPS is maximum frame rate gif viewers play correctly.
+const maxGIFFPS = 50
+
+// gifFPS returns frame rate of gif rendition of in with requested fps,
+// zero keeping source one.
+//
+// Gif frame delay is in centiseconds and most viewers slow down delays
+// below 2cs, so source timing is kept only up to maxGIFFPS. Source frame
+// rate is probed, as "source_fps" filter expressions need recent ffmpeg.
+func gifFPS(in string, fps int) int {
+	if fps > 0 && fps <= maxGIFFPS {
+		return fps
+	}
+	if info, err := probeMP4(in); err == nil && info.FPS > maxGIFFPS {
+		return maxGIFFPS
+	}
+	// Source frame rate is either playable or unknown, and then not
+	// duplicating frames of slower sources.
+	return 0
+}
+
+// loop returns value of ffmpeg muxer loop option for rendition.
+//
+// Gif muxer counts repeats after first play with -1 meaning no repeats,
+// while webp and apng count plays.
+func (r rendition) loop() string {
+	if r.Format == "gif" && r.Plays > 0 {
+		if r.Plays == 1 {
+			return "-1"
+		}
+		return strconv.Itoa(r.Plays - 1)
+	}
+	return strconv.Itoa(r.Plays)
+}
+
+// crf returns constant rate factor of rendition or def if not set.
+func (r rendition) crf(def int) int {
+	if r.CRF > 0 {
+		return r.CRF
+	}
+	return def
+}
+
+// filters returns common ffmpeg video filters for rendition.
+func (r rendition) filters() []string {
+	var filters []string
+	if r.FPS > 0 {
+		filters = append(filters, fmt.Sprintf("fps=%d", r.FPS))
+	}
+	if r.Width > 0 {
+		// Not upscaling small sources, "-2" keeps height even.
+		filters = append(filters, fmt.Sprintf("scale='min(%d,iw)':-2:flags=lanczos", r.Width))
+	}
+	if r.MaxDim > 0 {
+		filters = append(filters, fmt.Sprintf(
+			"scale='min(%[1]d,iw)':'min(%[1]d,ih)':force_original_aspect_ratio=decrease:flags=lanczos", r.MaxDim,
+		))
+	}
+	return filters
+}
+
+// args returns ffmpeg arguments to convert in to out.
+func (r rendition) args(in, out string) ([]string, error) {
+	args := []string{"-hide_banner", "-loglevel", "error", "-y"}
+	args = append(args, hwInputArgs(r.Encoder)...)
+	args = append(args, "-i", in, "-an")
+	if r.Length > 0 {
+		args = append(args, "-t", strconv.FormatFloat(r.Length.Seconds(), 'f', 3, 64))
+	}
+	filters := r.filters()
+	switch r.Format {
+	case "gif":
+		// Generating palette from source gives much better quality than
+		// default web-safe one.
+		palette := "palettegen"
+		if r.Quality > 0 {
+			colors := 256 * r.Quality / 100
+			if colors < 8 {
+				colors = 8
+			}
+			palette = fmt.Sprintf("palettegen=max_colors=%d", colors)
+		}
+		filters = append(filters, "split[s0][s1];[s0]"+palette+"[p];[s1][p]paletteuse")
+		args = append(args, "-vf", strings.Join(filters, ","), "-loop", r.loop(), "-f", "gif")
+	case "webp":
+		if len(filters) > 0 {
+			args = append(args, "-vf", strings.Join(filters, ","))
+		}
+		quality := r.Quality
+		if quality == 0 {
+			quality = 75
+		}
+		args = append(args, "-c:v", "libwebp", "-lossless", "0", "-quality", strconv.Itoa(quality), "-loop", r.loop(), "-f", "webp")
+	case "apng":
+		// Full color with alpha, unlike gif with 256 colors palette.
+		filters = append(filters, "format=rgba")
+		args = append(args, "-vf", strings.Join(filters, ","), "-plays", r.loop(), "-f", "apng")
+	case "mp4":
+		if r.Encoder == "h264_vaapi" {
+			// Frames are uploaded to GPU after software filters.
+			filters = append(filters, "format=nv12", "hwupload")
+		}
+		if len(filters) > 0 {
+			args = append(args, "-vf", strings.Join(filters, ","))
+		}
+		args = append(args, encoderArgs(r.Encoder, r.crf(23), r.Bitrate)...)
+		if r.Pass > 0 {
+			args = append(args, "-pass", strconv.Itoa(r.Pass), "-passlogfile", r.PassLog)
+		}
+		if r.Pass == 1 {
+			// First pass only collects stats.
+			return append(args, "-f", "null", os.DevNull), nil
+		}
+		args = append(args, "-movflags", "+faststart", "-f", "mp4")
+	case "webm":
+		if len(filters) > 0 {
+			args = append(args, "-vf", strings.Join(filters, ","))
+		}
+		// Keeping alpha channel, stickers are usually transparent.
+		args = append(args, "-c:v", "libvpx-vp9", "-b:v", "0", "-crf", strconv.Itoa(r.crf(30)), "-pix_fmt", "yuva420p", "-f", "webm")
+	default:
+		return nil, xerrors.Errorf("unsupported format %q", r.Format)
+	}
+	return append(args, out), nil
+}
+
+// convert renders in to out using ffmpeg from PATH.
+//
+// Output is written to temporary file first and renamed on success, so
+// interrupted conversion never leaves partial rendition at out.
+func convert(ctx context.Context, store storage, r rendition, in, out string) error {
+	tmp := store.TempName(out, ".tmp")
+	if r.Format == "gif" {
+		r.FPS = gifFPS(in, r.FPS)
+	}
+
+	passes := []rendition{r}
+	if r.Format == "mp4" && r.Bitrate > 0 && r.Encoder == "" {
+		// Two-pass encoding hits target bitrate much closer. Hardware
+		// encoders don't support it, so single pass is used with them.
+		first, second := r, r
+		first.Pass, first.PassLog = 1, tmp
+		second.Pass, second.PassLog = 2, tmp
+		passes = []rendition{first, second}
+		defer func() {
+			_ = os.Remove(tmp + "-0.log")
+			_ = os.Remove(tmp + "-0.log.mbtree")
+		}()
+	}
+	for _, p := range passes {
+		args, err := p.args(in, tmp)
+		if err != nil {
+			return err
+		}
+		if err := ffmpeg(ctx, args); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+	if err := store.Replace(tmp, out); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// decodeFrame checks that first frame of video decodes, if ffmpeg is
+// available.
+func decodeFrame(ctx context.Context, name string) error {
+	if !hasFFmpeg() {
+		return nil
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-v", "error", "-i", name,
+		"-frames:v", "1", "-f", "null", "-",
+	)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return xerrors.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// frameColor returns average color of first frame of video, scaling it by
+// ffmpeg to single pixel.
+func frameColor(ctx context.Context, name string) (string, error) {
+	if !hasFFmpeg() {
+		return "", errNoFFmpeg
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error", "-i", name,
+		"-vf", "scale=1:1:flags=area,format=rgb24",
+		"-frames:v", "1", "-f", "rawvideo", "-",
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", xerrors.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	p := stdout.Bytes()
+	if len(p) < 3 {
+		return "", xerrors.New("no frames")
+	}
+	return hexColor(p[0], p[1], p[2]), nil
+}
+
+// frameHashes returns difference hashes (dHash) of first frames of video.
+//
+// Each frame is scaled by ffmpeg to 9x8 grayscale and every bit of hash
+// tells whether pixel is brighter than its right neighbour, so hashes of
+// re-encoded or resized copies differ only in few bits.
+func frameHashes(ctx context.Context, name string) ([]uint64, error) {
+	const w, h = 9, 8
+	if !hasFFmpeg() {
+		return nil, errNoFFmpeg
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ffmpeg",
+		"-hide_banner", "-loglevel", "error", "-i", name,
+		"-vf", "fps=1,scale=9:8:flags=area,format=gray",
+		"-frames:v", strconv.Itoa(phashFrames), "-f", "rawvideo", "-",
+	)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, xerrors.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	raw := stdout.Bytes()
+	var hashes []uint64
+	for len(raw) >= w*h && len(hashes) < phashFrames {
+		var hash uint64
+		for y := 0; y < h; y++ {
+			for x := 0; x < w-1; x++ {
+				hash <<= 1
+				if raw[y*w+x] > raw[y*w+x+1] {
+					hash |= 1
+				}
+			}
+		}
+		hashes = append(hashes, hash)
+		raw = raw[w*h:]
+	}
+	if len(hashes) == 0 {
+		return nil, xerrors.New("no frames")
+	}
+	return hashes, nil
+}
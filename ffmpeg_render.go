@@ -0,0 +1,291 @@
+//go:build ffmpeg
+// +build ffmpeg
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// previewRendition is low-res rendition for bandwidth-friendly browsing.
+var previewRendition = rendition{Format: "mp4", MaxDim: 240, FPS: 15}
+
+// renderPreview renders short preview of downloaded video f.
+func (a *app) renderPreview(ctx context.Context, f file) error {
+	name := filepath.Join(a.opt.Out, f.Name)
+	out := previewName(name)
+	if _, err := os.Stat(out); err == nil {
+		return nil
+	}
+	if err := a.store.MkdirAll(filepath.Dir(out), 0o750); err != nil {
+		return err
+	}
+
+	r := previewRendition
+	r.Length = a.opt.Previews
+	r.Encoder = a.encoder
+	if err := convert(ctx, a.store, r, name, out); err != nil {
+		return err
+	}
+
+	a.log.Info("Rendered preview", zap.String("path", out))
+	return nil
+}
+
+// renderSprite renders sprite sheet of frames evenly taken from downloaded
+// video f and writes its frame map.
+func (a *app) renderSprite(ctx context.Context, f file) error {
+	name := filepath.Join(a.opt.Out, f.Name)
+	out := spriteName(name)
+	if _, err := os.Stat(out); err == nil {
+		return nil
+	}
+
+	m := f.Meta
+	if m.Duration == 0 || m.Width == 0 || m.Height == 0 {
+		info, err := probeMP4(name)
+		if err != nil {
+			return xerrors.Errorf("probe: %w", err)
+		}
+		m.Duration, m.Width, m.Height = info.Duration, info.Width, info.Height
+	}
+	if m.Duration <= 0 || m.Width == 0 || m.Height == 0 {
+		return xerrors.New("unknown duration or dimensions")
+	}
+	if a.opt.SpriteWidth <= 0 {
+		return xerrors.Errorf("invalid frame width %d", a.opt.SpriteWidth)
+	}
+
+	g := a.opt.Sprite
+	s := spriteMap{
+		Image:       filepath.Base(out),
+		Columns:     g.Columns,
+		Rows:        g.Rows,
+		FrameWidth:  a.opt.SpriteWidth,
+		FrameHeight: (a.opt.SpriteWidth*m.Height/m.Width + 1) &^ 1,
+	}
+	count := g.Columns * g.Rows
+	step := m.Duration / float64(count)
+	for i := 0; i < count; i++ {
+		s.Frames = append(s.Frames, spriteFrame{
+			X:    (i % g.Columns) * s.FrameWidth,
+			Y:    (i / g.Columns) * s.FrameHeight,
+			Time: float64(i) * step,
+		})
+	}
+
+	if err := a.store.MkdirAll(filepath.Dir(out), 0o750); err != nil {
+		return err
+	}
+	tmp := a.store.TempName(out, ".tmp")
+	if err := ffmpeg(ctx, []string{
+		"-hide_banner", "-loglevel", "error", "-y", "-i", name,
+		"-vf", fmt.Sprintf("fps=%f,scale=%d:%d:flags=lanczos,tile=%s",
+			1/step, s.FrameWidth, s.FrameHeight, g,
+		),
+		"-frames:v", "1", "-f", "image2", "-c:v", "mjpeg", "-q:v", "3", tmp,
+	}); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		_ = os.Remove(tmp)
+		return xerrors.Errorf("encode: %w", err)
+	}
+	mapName := strings.TrimSuffix(out, filepath.Ext(out)) + ".json"
+	if err := a.store.WriteFile(mapName, append(data, '\n'), 0o640); err != nil {
+		_ = os.Remove(tmp)
+		return xerrors.Errorf("write: %w", err)
+	}
+	if err := a.store.Replace(tmp, out); err != nil {
+		return err
+	}
+
+	a.log.Info("Rendered sprite sheet", zap.String("path", out))
+	return nil
+}
+
+// extractPoster extracts poster frame of downloaded video f next to it.
+func (a *app) extractPoster(ctx context.Context, f file) error {
+	name := filepath.Join(a.opt.Out, f.Name)
+	out := a.posterName(name)
+	if _, err := os.Stat(out); err == nil {
+		return nil
+	}
+
+	var at float64
+	if a.opt.PosterFrame == "middle" {
+		at = f.Meta.Duration / 2
+	}
+	tmp := a.store.TempName(out, ".tmp")
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-ss", strconv.FormatFloat(at, 'f', 3, 64), "-i", name,
+		"-frames:v", "1", "-f", "image2",
+	}
+	args = append(args, posterCodecs[a.opt.PosterFormat]...)
+	if err := ffmpeg(ctx, append(args, tmp)); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := a.store.Replace(tmp, out); err != nil {
+		return err
+	}
+
+	a.log.Info("Extracted poster", zap.String("path", out))
+	return nil
+}
+
+// embedProvenance writes provenance tags into downloaded mp4 f, remuxing it
+// without re-encoding.
+//
+// Standard tags are written to udta box, custom ones to mdta keys.
+func (a *app) embedProvenance(ctx context.Context, f file) error {
+	if f.Meta.MIME != "video/mp4" {
+		return nil
+	}
+	name := filepath.Join(a.opt.Out, f.Name)
+	tmp := a.store.TempName(name, ".tmp")
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-y", "-i", name,
+		"-map", "0", "-c", "copy", "-map_metadata", "0",
+	}
+	for _, tag := range a.provenanceTags(f) {
+		args = append(args, "-metadata", tag[0]+"="+tag[1])
+	}
+	args = append(args, "-movflags", "+use_metadata_tags+faststart", "-f", "mp4", tmp)
+	if err := ffmpeg(ctx, args); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := a.store.Replace(tmp, name); err != nil {
+		return err
+	}
+
+	a.log.Debug("Embedded provenance", zap.String("path", name))
+	return nil
+}
+
+// webmToMP4 converts downloaded VP9 webm video f, e.g. video sticker, to
+// H.264 mp4 next to it, flattening transparency onto background color.
+func (a *app) webmToMP4(ctx context.Context, f file) error {
+	name := filepath.Join(a.opt.Out, f.Name)
+	out := webmMP4Name(name)
+	if _, err := os.Stat(out); err == nil {
+		return nil
+	}
+
+	tmp := a.store.TempName(out, ".tmp")
+	// Native VP9 decoder ignores alpha channel, so using libvpx one.
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-c:v", "libvpx-vp9", "-i", name,
+		"-filter_complex", "color=c=" + a.opt.WebmBackground + "[bg];" +
+			"[bg][0:v]scale2ref[bg][v];" +
+			"[bg][v]overlay=shortest=1,scale=trunc(iw/2)*2:trunc(ih/2)*2,format=yuv420p",
+		"-an",
+	}
+	args = append(args, encoderArgs("", 23, 0)...)
+	args = append(args, "-movflags", "+faststart", "-f", "mp4", tmp)
+	if err := ffmpeg(ctx, args); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := a.store.Replace(tmp, out); err != nil {
+		return err
+	}
+	a.log.Info("Converted webm to mp4", zap.String("path", out))
+
+	if a.opt.ConvertReplace {
+		return os.Remove(name)
+	}
+	return nil
+}
+
+// watermark overlays image on mp4 at position ("tl", "tr", "bl", "br" or
+// "c"), returning name of temporary watermarked copy in temporary directory
+// of store.
+func watermark(ctx context.Context, store storage, in, image, position string) (string, error) {
+	xy, ok := watermarkPositions[position]
+	if !ok {
+		return "", xerrors.Errorf("unknown position %q", position)
+	}
+	tmp, err := os.CreateTemp(store.TempDir(), "telegifdl-*.mp4")
+	if err != nil {
+		return "", err
+	}
+	_ = tmp.Close()
+
+	args := []string{
+		"-hide_banner", "-loglevel", "error", "-y", "-i", in, "-i", image,
+		"-filter_complex", "[0:v][1:v]overlay=" + xy + ",format=yuv420p", "-an",
+	}
+	args = append(args, encoderArgs("", 23, 0)...)
+	args = append(args, "-movflags", "+faststart", "-f", "mp4", tmp.Name())
+	if err := ffmpeg(ctx, args); err != nil {
+		_ = os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// compileReel renders reel by ffmpeg.
+func (a *app) compileReel(ctx context.Context, r reel) error {
+	w, h := r.Width, r.Height
+	tmp, err := os.MkdirTemp(a.store.TempDir(), "telegifdl-compile")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	args := []string{"-hide_banner", "-loglevel", "error", "-y"}
+	var filters, parts []string
+	for i, clip := range r.Clips {
+		if r.Titles {
+			// Passing text as file avoids escaping of drawtext
+			// arguments.
+			text := filepath.Join(tmp, fmt.Sprintf("%d.txt", i))
+			if err := os.WriteFile(text, []byte(clipTitle(clip)), 0o600); err != nil {
+				return err
+			}
+			filters = append(filters, fmt.Sprintf(
+				"color=c=black:s=%dx%d:d=%g:r=30,drawtext=textfile=%s:fontcolor=white:fontsize=%d:"+
+					"x=(w-text_w)/2:y=(h-text_h)/2,format=yuv420p,setsar=1[t%d]",
+				w, h, r.TitleDuration, text, h/12, i,
+			))
+			parts = append(parts, fmt.Sprintf("[t%d]", i))
+		}
+		args = append(args, "-i", clip)
+		filters = append(filters, fmt.Sprintf(
+			"[%d:v]scale=%d:%d:force_original_aspect_ratio=decrease,"+
+				"pad=%d:%d:(ow-iw)/2:(oh-ih)/2:color=black,fps=30,format=yuv420p,setsar=1[v%d]",
+			i, w, h, w, h, i,
+		))
+		parts = append(parts, fmt.Sprintf("[v%d]", i))
+	}
+	filters = append(filters, fmt.Sprintf("%sconcat=n=%d:v=1:a=0[out]", strings.Join(parts, ""), len(parts)))
+
+	args = append(args, "-filter_complex", strings.Join(filters, ";"), "-map", "[out]", "-an")
+	args = append(args, encoderArgs("", 23, 0)...)
+	out := a.store.TempName(r.Output, ".tmp")
+	args = append(args, "-movflags", "+faststart", "-f", "mp4", out)
+
+	a.log.Info("Compiling", zap.Int("clips", len(r.Clips)), zap.String("output", r.Output))
+	if err := ffmpeg(ctx, args); err != nil {
+		_ = os.Remove(out)
+		return xerrors.Errorf("compile: %w", err)
+	}
+	return a.store.Replace(out, r.Output)
+}
@@ -0,0 +1,30 @@
+//go:build ffmpeg
+// +build ffmpeg
+
+package main
+
+import "testing"
+
+func TestGIFFPS(t *testing.T) {
+	for _, tt := range []struct {
+		Name   string
+		Source int
+		FPS    int
+		Result int
+	}{
+		{Name: "Source", Source: 25},
+		{Name: "FastSource", Source: 60, Result: maxGIFFPS},
+		{Name: "Requested", Source: 60, FPS: 15, Result: 15},
+		{Name: "RequestedFast", Source: 25, FPS: 60},
+		{Name: "RequestedFastOfFastSource", Source: 100, FPS: 60, Result: maxGIFFPS},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			if got := gifFPS(testVideo(t, 320, 240, tt.Source), tt.FPS); got != tt.Result {
+				t.Errorf("Got %d, expected %d", got, tt.Result)
+			}
+		})
+	}
+	if got := gifFPS("missing.mp4", 0); got != 0 {
+		t.Errorf("Got %d for unknown source", got)
+	}
+}
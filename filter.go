@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+// aspectTolerance is relative tolerance of aspect ratio filter.
+const aspectTolerance = 0.02
+
+// mediaFilter selects files by video dimensions, original file name and
+// MIME type.
+type mediaFilter struct {
+	// Aspect is width to height ratio, zero matches any.
+	Aspect float64
+	// MinResolution is minimum of smaller dimension, e.g. 480 for "480p".
+	MinResolution int
+	// Glob is pattern of original file name or MIME type, e.g. "*.webm" or
+	// "video/*", empty matches any.
+	Glob string
+	// NameGlob is pattern of original file name, e.g. "cat*", empty matches
+	// any.
+	NameGlob string
+}
+
+// parseMediaFilter parses aspect ratio ("16:9"), minimum resolution
+// ("480p") and globs, all optional.
+func parseMediaFilter(aspect, minResolution, match, matchName string) (mediaFilter, error) {
+	f := mediaFilter{
+		Glob:     strings.ToLower(match),
+		NameGlob: strings.ToLower(matchName),
+	}
+	for _, pattern := range []string{f.Glob, f.NameGlob} {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return f, xerrors.Errorf("invalid pattern %q", pattern)
+		}
+	}
+	if aspect != "" {
+		parts := strings.Split(aspect, ":")
+		if len(parts) != 2 {
+			return f, xerrors.Errorf("invalid aspect %q", aspect)
+		}
+		w, err1 := strconv.ParseFloat(parts[0], 64)
+		h, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil || w <= 0 || h <= 0 {
+			return f, xerrors.Errorf("invalid aspect %q", aspect)
+		}
+		f.Aspect = w / h
+	}
+	if minResolution != "" {
+		n, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(minResolution), "p"))
+		if err != nil || n <= 0 {
+			return f, xerrors.Errorf("invalid resolution %q", minResolution)
+		}
+		f.MinResolution = n
+	}
+	return f, nil
+}
+
+// Empty reports whether filter matches all files.
+func (f mediaFilter) Empty() bool {
+	return f.Aspect == 0 && f.MinResolution == 0 && f.Glob == "" && f.NameGlob == ""
+}
+
+// glob reports whether s matches pattern, ignoring case.
+func glob(pattern, s string) bool {
+	ok, _ := path.Match(pattern, strings.ToLower(s))
+	return ok
+}
+
+// Match reports whether file described by m matches filter. Files without
+// dimensions never match dimension filters, files without original name
+// never match name globs.
+func (f mediaFilter) Match(m metadata) bool {
+	if f.Glob != "" && !glob(f.Glob, m.FileName) && !glob(f.Glob, m.MIME) {
+		return false
+	}
+	if f.NameGlob != "" && (m.FileName == "" || !glob(f.NameGlob, m.FileName)) {
+		return false
+	}
+	if f.Aspect == 0 && f.MinResolution == 0 {
+		return true
+	}
+	if m.Width <= 0 || m.Height <= 0 {
+		return false
+	}
+	if f.Aspect > 0 {
+		ratio := float64(m.Width) / float64(m.Height)
+		if math.Abs(ratio-f.Aspect)/f.Aspect > aspectTolerance {
+			return false
+		}
+	}
+	if f.MinResolution > 0 {
+		min := m.Width
+		if m.Height < min {
+			min = m.Height
+		}
+		if min < f.MinResolution {
+			return false
+		}
+	}
+	return true
+}
+
+// filtered returns source sending only files of src matching filter.
+func (f mediaFilter) filtered(src source) source {
+	return func(ctx context.Context, files chan<- file) error {
+		all := make(chan file)
+		g, ctx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			defer close(all)
+			return src(ctx, all)
+		})
+		g.Go(func() error {
+			for file := range all {
+				if !f.Match(file.Meta) {
+					continue
+				}
+				if err := send(ctx, files, file); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return g.Wait()
+	}
+}
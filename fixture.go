@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tdp"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"golang.org/x/xerrors"
+)
+
+// fixtureCall is single recorded RPC call, stored as JSON line.
+type fixtureCall struct {
+	// Profile is profile of account making call, empty for default session.
+	Profile string `json:"profile,omitempty"`
+	// Method is TL name of request, for readability only.
+	Method string `json:"method,omitempty"`
+	// Request is hash of encoded request.
+	Request string `json:"request"`
+	// Type is hex type ID of request.
+	Type string `json:"type"`
+	// Response is encoded response, if call succeeded.
+	Response []byte `json:"response,omitempty"`
+	// Code and Error describe RPC error, if call failed.
+	Code  int    `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+	// RandomID is random ID of request, e.g. of sent message, which is
+	// echoed in response.
+	RandomID int64 `json:"random_id,omitempty"`
+}
+
+// randomID returns random ID of request, if it has one.
+func randomID(input bin.Encoder) int64 {
+	if r, ok := input.(interface{ GetRandomID() int64 }); ok {
+		return r.GetRandomID()
+	}
+	return 0
+}
+
+// encodeRequest returns hash and hex type ID of encoded request.
+func encodeRequest(input bin.Encoder) (hash, typ string, err error) {
+	var b bin.Buffer
+	if err := input.Encode(&b); err != nil {
+		return "", "", err
+	}
+	if b.Len() < 4 {
+		return "", "", xerrors.New("request too short")
+	}
+	sum := sha256.Sum256(b.Buf)
+	return hex.EncodeToString(sum[:]), hex.EncodeToString(b.Buf[:4]), nil
+}
+
+// methodName returns TL name of request, if known.
+func methodName(input bin.Encoder) string {
+	if t, ok := input.(interface{ TypeInfo() tdp.Type }); ok {
+		return t.TypeInfo().Name
+	}
+	return ""
+}
+
+// recorder is middleware recording RPC calls to fixture file, which can be
+// replayed by replayer to run commands without connecting to Telegram.
+//
+// Fixture contains all requested data, including downloaded files and
+// private messages.
+type recorder struct {
+	mux sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// newRecorder creates recorder writing fixture to name.
+func newRecorder(store storage, name string) (*recorder, error) {
+	f, err := store.Create(name, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &recorder{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Profile returns middleware recording calls of account of profile.
+func (r *recorder) Profile(profile string) telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return r.handle(profile, next)
+	})
+}
+
+// handle records calls of profile to next.
+func (r *recorder) handle(profile string, next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		callErr := next.Invoke(ctx, input, output)
+		if ctx.Err() != nil {
+			return callErr
+		}
+
+		hash, typ, err := encodeRequest(input)
+		if err != nil {
+			return xerrors.Errorf("record: %w", err)
+		}
+		call := fixtureCall{
+			Profile:  profile,
+			Method:   methodName(input),
+			Request:  hash,
+			Type:     typ,
+			RandomID: randomID(input),
+		}
+		if rpcErr, ok := tgerr.As(callErr); ok {
+			call.Code, call.Error = rpcErr.Code, rpcErr.Message
+		} else if callErr != nil {
+			// Transport errors are not reproducible.
+			return callErr
+		} else if enc, ok := output.(bin.Encoder); ok {
+			var b bin.Buffer
+			if err := enc.Encode(&b); err != nil {
+				return xerrors.Errorf("record: %w", err)
+			}
+			call.Response = b.Buf
+		}
+
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		if err := r.enc.Encode(call); err != nil {
+			return xerrors.Errorf("record: %w", err)
+		}
+		return callErr
+	}
+}
+
+// Close closes fixture file.
+func (r *recorder) Close() error {
+	return r.f.Close()
+}
+
+// replayer answers requests of profiles by recorded fixture.
+//
+// Requests are matched by content first and by type then, as some requests
+// contain random values, e.g. uploaded file IDs. Calls with same key are
+// answered in recorded order, repeating last answer when exhausted. Random
+// ID of request is substituted for recorded one in response, so replayed
+// response refers to replayed request.
+type replayer struct {
+	mux    sync.Mutex
+	calls  map[string][]fixtureCall
+	byType map[string][]fixtureCall
+}
+
+// openReplayer loads fixture from name.
+func openReplayer(name string) (*replayer, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	r := &replayer{
+		calls:  map[string][]fixtureCall{},
+		byType: map[string][]fixtureCall{},
+	}
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 64<<20)
+	for s.Scan() {
+		var call fixtureCall
+		if err := json.Unmarshal(s.Bytes(), &call); err != nil {
+			return nil, xerrors.Errorf("decode: %w", err)
+		}
+		r.calls[call.Profile+"/"+call.Request] = append(r.calls[call.Profile+"/"+call.Request], call)
+		r.byType[call.Profile+"/"+call.Type] = append(r.byType[call.Profile+"/"+call.Type], call)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// popCall pops next call of key from calls.
+func popCall(calls map[string][]fixtureCall, key string) (fixtureCall, bool) {
+	queue := calls[key]
+	if len(queue) == 0 {
+		return fixtureCall{}, false
+	}
+	if len(queue) > 1 {
+		calls[key] = queue[1:]
+	}
+	return queue[0], true
+}
+
+// Profile returns invoker answering requests of account of profile.
+func (r *replayer) Profile(profile string) tg.Invoker {
+	return telegram.InvokeFunc(func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		return r.invoke(ctx, profile, input, output)
+	})
+}
+
+// invoke answers request of profile.
+func (r *replayer) invoke(ctx context.Context, profile string, input bin.Encoder, output bin.Decoder) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	hash, typ, err := encodeRequest(input)
+	if err != nil {
+		return err
+	}
+
+	r.mux.Lock()
+	call, ok := popCall(r.calls, profile+"/"+hash)
+	if !ok {
+		call, ok = popCall(r.byType, profile+"/"+typ)
+	}
+	r.mux.Unlock()
+	if !ok {
+		return xerrors.Errorf("replay: no recorded call of %s", methodName(input))
+	}
+
+	if call.Error != "" {
+		return tgerr.New(call.Code, call.Error)
+	}
+	response := call.Response
+	if id := randomID(input); call.RandomID != 0 && id != call.RandomID {
+		recorded, requested := make([]byte, 8), make([]byte, 8)
+		binary.LittleEndian.PutUint64(recorded, uint64(call.RandomID))
+		binary.LittleEndian.PutUint64(requested, uint64(id))
+		response = bytes.ReplaceAll(response, recorded, requested)
+	}
+	return output.Decode(&bin.Buffer{Buf: response})
+}
+
+// replay runs handler with clients answering by recorded fixture instead of
+// connecting to Telegram.
+func (a *app) replay(ctx context.Context, profiles []string, handler func(ctx context.Context, a *app) error) error {
+	r, err := openReplayer(a.opt.Replay)
+	if err != nil {
+		return xerrors.Errorf("replay: %w", err)
+	}
+	return a.withInvokers(ctx, profiles, r.Profile, handler)
+}
+
+// withInvokers runs handler with accounts of profiles answered by invokers
+// instead of connecting to Telegram.
+func (a *app) withInvokers(
+	ctx context.Context, profiles []string,
+	invoker func(profile string) tg.Invoker,
+	handler func(ctx context.Context, a *app) error,
+) error {
+	a.accounts = nil
+	for _, profile := range profiles {
+		invoker := invoker(profile)
+		if a.opt.Trace {
+			invoker = tracer{log: a.log.Named("trace")}.Handle(invoker)
+		}
+		if a.recorder != nil {
+			invoker = a.recorder.Profile(profile).Handle(invoker)
+		}
+		api := tg.NewClient(invoker)
+		users, err := api.UsersGetUsers(ctx, []tg.InputUserClass{&tg.InputUserSelf{}})
+		if err != nil {
+			return xerrors.Errorf("self %q: %w", profile, err)
+		}
+		self, ok := tg.UserClassArray(users).FirstAsNotEmpty()
+		if !ok {
+			return xerrors.Errorf("self %q: no user", profile)
+		}
+		a.accounts = append(a.accounts, account{Profile: profile, API: api, Invoker: invoker, Self: self})
+	}
+
+	a.api = a.accounts[0].API
+	return handler(ctx, a)
+}
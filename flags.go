@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// byteSize is flag.Value for human-readable sizes like "8MB" or "512K".
+//
+// Units are binary, i.e. 1KB is 1024 bytes, as most platforms count
+// upload limits that way.
+type byteSize int64
+
+var sizeUnits = []struct {
+	suffix string
+	mul    int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"G", 1 << 30},
+	{"M", 1 << 20},
+	{"K", 1 << 10},
+	{"B", 1},
+}
+
+func (s byteSize) String() string {
+	for _, u := range sizeUnits {
+		if len(u.suffix) == 2 && s != 0 && int64(s)%u.mul == 0 {
+			return fmt.Sprintf("%d%s", int64(s)/u.mul, u.suffix)
+		}
+	}
+	return strconv.FormatInt(int64(s), 10)
+}
+
+func (s *byteSize) Set(v string) error {
+	v = strings.ToUpper(strings.TrimSpace(v))
+	mul := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(v, u.suffix) {
+			mul = u.mul
+			v = strings.TrimSpace(strings.TrimSuffix(v, u.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return xerrors.Errorf("invalid size %q", v)
+	}
+	*s = byteSize(n * float64(mul))
+	return nil
+}
+
+// stringsFlag is flag.Value for repeatable string flag.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
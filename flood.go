@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/telegram"
+	"go.uber.org/zap"
+)
+
+// waitFlood waits for FLOOD_WAIT duration if err is flood wait error,
+// reporting whether request should be retried.
+func (a *app) waitFlood(ctx context.Context, err error) (bool, error) {
+	d, ok := telegram.AsFloodWait(err)
+	if !ok {
+		return false, nil
+	}
+	a.log.Warn("Flood wait", zap.Duration("duration", d))
+
+	if err := a.sleep(ctx, d+time.Second); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// retryFlood calls f until it returns error other than flood wait.
+func (a *app) retryFlood(ctx context.Context, f func(ctx context.Context) error) error {
+	for {
+		err := f(ctx)
+		retry, waitErr := a.waitFlood(ctx, err)
+		if waitErr != nil {
+			return waitErr
+		}
+		if !retry {
+			return err
+		}
+	}
+}
+
+// sleep waits for d by app clock or until ctx is done.
+func (a *app) sleep(ctx context.Context, d time.Duration) error {
+	timer := a.clock.Timer(d)
+	defer clock.StopTimer(timer)
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
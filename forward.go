@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/telegram/message"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// progress is append-only list of processed document IDs, allowing to
+// resume interrupted operation.
+type progress struct {
+	store storage
+	path  string
+	done  map[int64]struct{}
+}
+
+// openProgress loads progress from path, if any.
+func openProgress(store storage, path string) (*progress, error) {
+	p := &progress{store: store, path: path, done: map[int64]struct{}{}}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		id, err := strconv.ParseInt(strings.TrimSpace(s.Text()), 10, 64)
+		if err != nil {
+			continue
+		}
+		p.done[id] = struct{}{}
+	}
+	return p, s.Err()
+}
+
+// Done reports whether id was already processed.
+func (p *progress) Done(id int64) bool {
+	_, ok := p.done[id]
+	return ok
+}
+
+// Add records id as processed.
+func (p *progress) Add(id int64) error {
+	f, err := p.store.Append(p.path, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, id); err != nil {
+		_ = f.Close()
+		return err
+	}
+	p.done[id] = struct{}{}
+	return f.Close()
+}
+
+// forwardCmd sends every saved gif to chat as document reference, without
+// re-uploading.
+func forwardCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	interval := fs.Duration("interval", time.Second, "delay between sent messages")
+	return func(ctx context.Context, a *app) error {
+		if fs.NArg() != 1 {
+			return xerrors.New("usage: forward [flags] <peer>")
+		}
+
+		sender := message.NewSender(a.api)
+		peer, err := sender.Resolve(fs.Arg(0)).AsInputPeer(ctx)
+		if err != nil {
+			return xerrors.Errorf("resolve %q: %w", fs.Arg(0), err)
+		}
+
+		docs, err := listSavedGifs(ctx, a.api)
+		if err != nil {
+			return err
+		}
+
+		// Progress is kept per peer, so interrupted forward can be resumed.
+		if err := a.store.MkdirAll(a.opt.Out, 0o750); err != nil {
+			return xerrors.Errorf("mkdir: %w", err)
+		}
+		p, err := openProgress(a.store, filepath.Join(a.opt.Out, fmt.Sprintf(".forward-%s", peerDir(peer))))
+		if err != nil {
+			return xerrors.Errorf("progress: %w", err)
+		}
+
+		sent := 0
+		// Sending oldest first, so chat follows save order.
+		for i := len(docs) - 1; i >= 0; i-- {
+			doc := docs[i]
+			if p.Done(doc.ID) {
+				continue
+			}
+
+			if err := a.retryFlood(ctx, func(ctx context.Context) error {
+				_, err := sender.To(peer).Media(ctx, message.Document(doc))
+				return err
+			}); err != nil {
+				return xerrors.Errorf("send %d: %w", doc.ID, err)
+			}
+			if err := p.Add(doc.ID); err != nil {
+				return xerrors.Errorf("progress: %w", err)
+			}
+			sent++
+			a.log.Info("Sent", zap.Int64("id", doc.ID))
+
+			if err := a.sleep(ctx, *interval); err != nil {
+				return err
+			}
+		}
+
+		a.log.Info("Forward finished",
+			zap.Int("sent", sent),
+			zap.Int("total", len(docs)),
+		)
+		return nil
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// tempSuffixes are suffixes passed to tempName.
+var tempSuffixes = []string{".part", ".tmp", ".tmp.gif"}
+
+// staleTemp reports whether name is temporary file written next to output
+// one by tempName, e.g. ".123.mp4.part" of partial download.
+func staleTemp(name string) bool {
+	if !strings.HasPrefix(name, ".") {
+		return false
+	}
+	for _, suffix := range tempSuffixes {
+		base := strings.TrimSuffix(name[1:], suffix)
+		if len(base) == len(name)-1 {
+			continue
+		}
+		// Output files are never hidden and always have extension.
+		if base != "" && !strings.HasPrefix(base, ".") && filepath.Ext(base) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isTempDir reports whether dir is system temporary directory, which is
+// shared with other programs.
+func isTempDir(dir string) bool {
+	resolve := func(p string) string {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if resolved, err := filepath.EvalSymlinks(p); err == nil {
+			p = resolved
+		}
+		return p
+	}
+	return resolve(dir) == resolve(os.TempDir())
+}
+
+// garbage is stale file or directory.
+type garbage struct {
+	Path string
+	Size int64
+}
+
+// diskUsage returns total size of files in path.
+func diskUsage(path string) int64 {
+	var size int64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// findGarbage returns temporary files modified before deadline: partial and
+// temporary files in output directory and scratch files and directories of
+// runs in tmp directory. Unreadable directories and files are skipped.
+func findGarbage(out, tmpDir string, deadline time.Time) ([]garbage, error) {
+	var found []garbage
+	err := filepath.WalkDir(out, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// E.g. directory of other user or removed concurrently.
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !staleTemp(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.ModTime().Before(deadline) {
+			found = append(found, garbage{Path: path, Size: info.Size()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("walk: %w", err)
+	}
+
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, xerrors.Errorf("tmp dir: %w", err)
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), "telegifdl-") {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if !info.ModTime().Before(deadline) {
+			continue
+		}
+		path := filepath.Join(tmpDir, e.Name())
+		found = append(found, garbage{Path: path, Size: diskUsage(path)})
+	}
+	return found, nil
+}
+
+// collectGarbage removes temporary files left by interrupted runs which are
+// older than age, returning count of removed files and reclaimed bytes.
+func (a *app) collectGarbage(age time.Duration, dryRun bool) (int, int64, error) {
+	tmpDir := a.opt.TmpDir
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+	found, err := findGarbage(a.opt.Out, tmpDir, a.clock.Now().Add(-age))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var reclaimed int64
+	for _, g := range found {
+		a.log.Info("Removing stale temporary file", zap.String("path", g.Path), zap.Int64("size", g.Size))
+		if dryRun {
+			continue
+		}
+		if err := os.RemoveAll(g.Path); err != nil {
+			return 0, 0, xerrors.Errorf("remove: %w", err)
+		}
+		reclaimed += g.Size
+	}
+	return len(found), reclaimed, nil
+}
+
+// gcCmd removes stale temporary files, reporting reclaimed space.
+func gcCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	dryRun := fs.Bool("dry-run", false, "only report stale files")
+	return func(ctx context.Context, a *app) error {
+		if a.opt.GCAge <= 0 {
+			return xerrors.New("gc age must be positive")
+		}
+		n, reclaimed, err := a.collectGarbage(a.opt.GCAge, *dryRun)
+		if err != nil {
+			return err
+		}
+		a.log.Info("Collected garbage",
+			zap.Int("files", n),
+			zap.Int64("reclaimed", reclaimed),
+		)
+		return nil
+	}
+}
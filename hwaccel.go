@@ -0,0 +1,107 @@
+//go:build ffmpeg
+// +build ffmpeg
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+
+	"golang.org/x/xerrors"
+)
+
+// vaapiDevice is default VAAPI render node.
+const vaapiDevice = "/dev/dri/renderD128"
+
+// hwEncoders maps hwaccel modes to ffmpeg h264 encoders, in order of
+// detection preference.
+var hwEncoders = []struct {
+	Mode    string
+	Encoder string
+}{
+	{"nvenc", "h264_nvenc"},
+	{"videotoolbox", "h264_videotoolbox"},
+	{"vaapi", "h264_vaapi"},
+}
+
+// encoderArgs returns ffmpeg arguments selecting h264 encoder with crf-like
+// quality or bitrate in kbit/s, if not zero.
+func encoderArgs(encoder string, crf, bitrate int) []string {
+	var args []string
+	switch encoder {
+	case "h264_nvenc":
+		args = []string{"-c:v", encoder, "-preset", "p5", "-pix_fmt", "yuv420p"}
+		if bitrate == 0 {
+			args = append(args, "-rc", "vbr", "-cq", strconv.Itoa(crf), "-b:v", "0")
+		}
+	case "h264_vaapi":
+		args = []string{"-c:v", encoder}
+		if bitrate == 0 {
+			args = append(args, "-qp", strconv.Itoa(crf))
+		}
+	case "h264_videotoolbox":
+		args = []string{"-c:v", encoder, "-pix_fmt", "yuv420p"}
+		if bitrate == 0 {
+			// VideoToolbox quality is 1-100, higher is better.
+			args = append(args, "-q:v", strconv.Itoa(100-2*crf))
+		}
+	default:
+		args = []string{"-c:v", "libx264", "-preset", "medium", "-pix_fmt", "yuv420p"}
+		if bitrate == 0 {
+			args = append(args, "-crf", strconv.Itoa(crf))
+		}
+	}
+	if bitrate > 0 {
+		args = append(args, "-b:v", fmt.Sprintf("%dk", bitrate))
+	}
+	return args
+}
+
+// hwInputArgs returns ffmpeg arguments preceding input for encoder.
+func hwInputArgs(encoder string) []string {
+	if encoder == "h264_vaapi" {
+		return []string{"-vaapi_device", vaapiDevice}
+	}
+	return nil
+}
+
+// probeEncoder reports whether ffmpeg can encode with encoder on this
+// machine, encoding few frames of test source.
+func probeEncoder(ctx context.Context, encoder string) bool {
+	args := append([]string{"-hide_banner", "-loglevel", "error"}, hwInputArgs(encoder)...)
+	args = append(args, "-f", "lavfi", "-i", "testsrc=size=256x256:duration=0.2")
+	if encoder == "h264_vaapi" {
+		args = append(args, "-vf", "format=nv12,hwupload")
+	}
+	args = append(args, encoderArgs(encoder, 23, 0)...)
+	args = append(args, "-f", "null", "-")
+	return hasFFmpeg() && exec.CommandContext(ctx, "ffmpeg", args...).Run() == nil
+}
+
+// hwEncoder returns h264 encoder for hwaccel mode: "none", "auto" or one
+// of hwEncoders. Empty encoder means software one.
+func hwEncoder(ctx context.Context, mode string) (string, error) {
+	switch mode {
+	case "", "none":
+		return "", nil
+	case "auto":
+		for _, e := range hwEncoders {
+			if probeEncoder(ctx, e.Encoder) {
+				return e.Encoder, nil
+			}
+		}
+		return "", nil
+	}
+	for _, e := range hwEncoders {
+		if e.Mode != mode {
+			continue
+		}
+		if !probeEncoder(ctx, e.Encoder) {
+			return "", xerrors.Errorf("encoder %s is not available", e.Encoder)
+		}
+		return e.Encoder, nil
+	}
+	return "", xerrors.Errorf("unknown hwaccel %q", mode)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// lang is language of user-facing messages, detected from environment and
+// overridden by --lang.
+var lang = envLang()
+
+// catalog is translations of user-facing messages (prompts, reports and
+// errors) keyed by English message, which is used if translation is
+// missing. Logs are not translated.
+var catalog = map[string]map[string]string{
+	"en": {},
+	"ru": {
+		// Authentication.
+		"Enter code: ":         "Введите код: ",
+		"Enter phone: ":        "Введите номер телефона: ",
+		"Enter 2FA password: ": "Введите пароль двухфакторной аутентификации: ",
+
+		// Prompts.
+		"Unsave? [y/N/a(ll)] ":                                                     "Удалить из сохранённых? [y/N/a(все)] ",
+		"Content is not compared, unsave anyway? [y/N] ":                           "Содержимое не сравнивалось, всё равно удалить из сохранённых? [y/N] ",
+		"Select results (e.g. 1,3-5 or all): ":                                     "Выберите результаты (например, 1,3-5 или all): ",
+		"Resume, restart or inspect? [R/s/i] ":                                     "Продолжить, начать заново или просмотреть? [R/s/i] ",
+		"Previous run of %q started at %s did not finish, %d files were completed": "Предыдущий запуск %q, начатый %s, не завершился, готово файлов: %d",
+		"Apply plan? [y/N] ":                                                       "Применить план? [y/N] ",
+		"Plan is not applied, confirm it or use --apply\n":                         "План не применён, подтвердите его или используйте --apply\n",
+		", last one is %s":                                                         ", последний: %s",
+
+		// Reports.
+		"%d duplicates %d (same %s)\n":                "%d дублирует %d (совпадает %s)\n",
+		"%s (kept)\n":                                 "%s (оставлен)\n",
+		"same content":                                "то же содержимое",
+		"similar, distance %d":                        "похож, расстояние %d",
+		"%3d. %d %dx%d %ds %d bytes\n":                "%3d. %d %dx%d %dс %d байт\n",
+		"telegifdl %s is up to date\n":                "telegifdl %s — последняя версия\n",
+		"telegifdl %s is available (current is %s)\n": "Доступна версия telegifdl %s (текущая %s)\n",
+		"Gifs:\t%d\n":                                 "Гифок:\t%d\n",
+		"Total size:\t%s\n":                           "Общий размер:\t%s\n",
+		"Average size:\t%s\n":                         "Средний размер:\t%s\n",
+		"Average duration:\t%.1fs\n":                  "Средняя длительность:\t%.1fс\n",
+		"\nPer year of upload:":                       "\nПо году загрузки:",
+		"\nAspect ratio:":                             "\nСоотношение сторон:",
+		"\nLargest:":                                  "\nСамые большие:",
+
+		// Usage.
+		"Usage: %s [flags] [command] [command flags]\n\nCommands:\n": "Использование: %s [флаги] [команда] [флаги команды]\n\nКоманды:\n",
+		"\nFlags:":                      "\nФлаги:",
+		"download saved gifs (default)": "скачать сохранённые гифки (по умолчанию)",
+		"download stickers: recent, faved, installed, set <shortname>":                      "скачать стикеры: recent, faved, installed, set <имя набора>",
+		"download profile photos of current or provided user":                               "скачать фото профиля текущего или указанного пользователя",
+		"download all media from Saved Messages":                                            "скачать все медиа из «Избранного»",
+		"download media of selected kinds from chat":                                        "скачать медиа выбранных типов из чата",
+		"search gifs via inline bot, download or save selected ones":                        "искать гифки через инлайн-бота, скачать или сохранить выбранные",
+		"send all saved gifs to chat":                                                       "отправить все сохранённые гифки в чат",
+		"copy saved gifs to private backup channel":                                         "скопировать сохранённые гифки в закрытый канал",
+		"save gifs from backup channel to saved gifs":                                       "сохранить гифки из канала резервной копии",
+		"list saved gifs metadata":                                                          "вывести метаданные сохранённых гифок",
+		"re-save saved gifs in manifest order":                                              "пересохранить гифки в порядке манифеста",
+		"move saved gifs to the top of gif panel":                                           "поднять сохранённые гифки в начало панели",
+		"find duplicate saved gifs and unsave them":                                         "найти дубликаты сохранённых гифок и удалить их",
+		"print saved gifs stats":                                                            "вывести статистику сохранённых гифок",
+		"download installed chat wallpapers and theme files":                                "скачать установленные обои чатов и файлы тем",
+		"find duplicate downloaded gifs, optionally visually similar ones":                  "найти дубликаты скачанных гифок, в том числе визуально похожие",
+		"concatenate downloaded gifs into single video":                                     "склеить скачанные гифки в одно видео",
+		"replace binary with latest release":                                                "обновить программу до последней версии",
+		"copy saved gifs of first profile to second one":                                    "скопировать сохранённые гифки первого профиля во второй",
+		"compare manifests, manifest and output directory, or output directory and account": "сравнить манифесты, манифест с каталогом загрузок или каталог загрузок с аккаунтом",
+		"remove stale partial and temporary files of interrupted runs":                      "удалить устаревшие недокачанные и временные файлы прерванных запусков",
+		"convert downloaded gifs to platform-constrained renditions":                        "сконвертировать скачанные гифки под ограничения платформ",
+
+		// Errors.
+		"run interrupted":                               "запуск прерван",
+		"run interrupted: %d of %d completed":           "запуск прерван: готово %d из %d",
+		"%s, run same command again to resume\n":        "%s, запустите ту же команду снова, чтобы продолжить\n",
+		"Error: %v\n":                                   "Ошибка: %v\n",
+		"unknown command %q":                            "неизвестная команда %q",
+		"unknown language %q, expected %s":              "неизвестный язык %q, ожидается %s",
+		"usage: mirror --profile <from> --profile <to>": "использование: mirror --profile <откуда> --profile <куда>",
+	},
+}
+
+// envLang returns language from locale environment variables, e.g. "ru" for
+// LANG=ru_RU.UTF-8, falling back to English for unknown ones.
+func envLang() string {
+	// First set variable takes precedence, as in POSIX locale.
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		v := os.Getenv(name)
+		if v == "" {
+			continue
+		}
+		v = strings.ToLower(v)
+		if i := strings.IndexAny(v, "_.@-"); i >= 0 {
+			v = v[:i]
+		}
+		if _, ok := catalog[v]; ok {
+			return v
+		}
+		break
+	}
+	return "en"
+}
+
+// setLang sets language of messages, if not empty.
+func setLang(l string) error {
+	if l == "" {
+		return nil
+	}
+	if _, ok := catalog[l]; !ok {
+		known := make([]string, 0, len(catalog))
+		for k := range catalog {
+			known = append(known, k)
+		}
+		sort.Strings(known)
+		return xerrors.Errorf(tr("unknown language %q, expected %s"), l, strings.Join(known, ", "))
+	}
+	lang = l
+	return nil
+}
+
+// tr returns translation of English message to current language.
+func tr(msg string) string {
+	if t, ok := catalog[lang][msg]; ok {
+		return t
+	}
+	return msg
+}
+
+// trf formats translated message.
+func trf(format string, args ...interface{}) string {
+	return fmt.Sprintf(tr(format), args...)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// relinkModes are modes of placing files found by index into output.
+var relinkModes = map[string]struct{}{
+	"":     {},
+	"copy": {},
+	"move": {},
+}
+
+// indexEntry is downloaded file of document.
+type indexEntry struct {
+	ID   int64  `json:"id"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// indexPath returns path of download index of profile.
+func indexPath(profile string) (string, error) {
+	lock, err := sessionLockPath(profile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(lock), "index.jsonl"), nil
+}
+
+// downloadIndex maps document IDs to absolute paths of downloaded files.
+// It is stored per profile next to session, so files are found after
+// output directory or naming is changed.
+type downloadIndex struct {
+	mux      sync.Mutex
+	profiles map[string]map[int64]indexEntry
+}
+
+// load returns index of profile, reading it on first call. Must be called
+// with lock held.
+func (x *downloadIndex) load(profile string) (map[int64]indexEntry, error) {
+	if entries, ok := x.profiles[profile]; ok {
+		return entries, nil
+	}
+	path, err := indexPath(profile)
+	if err != nil {
+		return nil, err
+	}
+	entries := map[int64]indexEntry{}
+	f, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		defer func() { _ = f.Close() }()
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			var e indexEntry
+			if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+				// Last line can be partially written by crashed run.
+				continue
+			}
+			entries[e.ID] = e
+		}
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+	}
+	if x.profiles == nil {
+		x.profiles = map[string]map[int64]indexEntry{}
+	}
+	x.profiles[profile] = entries
+	return entries, nil
+}
+
+// Lookup returns entry of document in index of profile.
+func (x *downloadIndex) Lookup(profile string, id int64) (indexEntry, bool, error) {
+	x.mux.Lock()
+	defer x.mux.Unlock()
+
+	entries, err := x.load(profile)
+	if err != nil {
+		return indexEntry{}, false, err
+	}
+	e, ok := entries[id]
+	return e, ok, nil
+}
+
+// Add records downloaded file in index of profile.
+func (x *downloadIndex) Add(store storage, profile string, e indexEntry) error {
+	x.mux.Lock()
+	defer x.mux.Unlock()
+
+	entries, err := x.load(profile)
+	if err != nil {
+		return err
+	}
+	entries[e.ID] = e
+
+	path, err := indexPath(profile)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := store.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := store.Append(path, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// indexFile records file of f downloaded to name in index of profile.
+func (a *app) indexFile(profile string, f file, name string) {
+	if a.opt.ReadOnly {
+		// Index is shared with runs using same session.
+		return
+	}
+	abs, err := filepath.Abs(name)
+	if err == nil {
+		var stat os.FileInfo
+		if stat, err = os.Stat(abs); err == nil {
+			err = a.index.Add(a.store, profile, indexEntry{ID: f.Meta.ID, Path: abs, Size: stat.Size()})
+		}
+	}
+	if err != nil {
+		a.log.Warn("Failed to index file", zap.String("path", name), zap.Error(err))
+	}
+}
+
+// indexExisting records file of f found at name in index of profile, if it
+// is not indexed yet, e.g. downloaded before index was introduced.
+func (a *app) indexExisting(profile string, f file, name string) {
+	abs, err := filepath.Abs(name)
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(abs); err != nil {
+		// E.g. replaced by converted file.
+		return
+	}
+	if e, ok, err := a.index.Lookup(profile, f.Meta.ID); err == nil && ok && e.Path == abs {
+		return
+	}
+	a.indexFile(profile, f, abs)
+}
+
+// indexed returns entry of document in index of profile if its file still
+// exists and is not changed since.
+func (a *app) indexed(profile string, id int64) (indexEntry, bool, error) {
+	e, ok, err := a.index.Lookup(profile, id)
+	if err != nil {
+		return indexEntry{}, false, xerrors.Errorf("index: %w", err)
+	}
+	if !ok {
+		return indexEntry{}, false, nil
+	}
+	stat, err := os.Stat(e.Path)
+	if err != nil || stat.Size() != e.Size {
+		// Removed or changed since.
+		return indexEntry{}, false, nil
+	}
+	return e, true, nil
+}
+
+// downloadedElsewhere reports whether document of f is already downloaded
+// to path other than name, e.g. by run with other output directory. With
+// relink file is copied or moved to name.
+func (a *app) downloadedElsewhere(profile string, f file, name string) (bool, error) {
+	e, ok, err := a.indexed(profile, f.Meta.ID)
+	if err != nil || !ok {
+		return false, err
+	}
+	if abs, err := filepath.Abs(name); err == nil && abs == e.Path {
+		return false, nil
+	}
+
+	log := a.log.With(zap.Int64("id", f.Meta.ID), zap.String("path", e.Path))
+	if a.opt.Relink == "" {
+		log.Info("Already downloaded elsewhere, skipping")
+		return true, nil
+	}
+	if err := a.store.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return false, xerrors.Errorf("mkdir: %w", err)
+	}
+	if a.opt.Relink == "move" {
+		err := a.store.Rename(e.Path, name)
+		var linkErr *os.LinkError
+		switch {
+		case err == nil:
+			log.Info("Moved", zap.String("to", name))
+			a.indexFile(profile, f, name)
+			return true, nil
+		case !xerrors.As(err, &linkErr):
+			// Moved, but permissions were not applied.
+			return false, err
+		}
+		// E.g. other volume, copying and removing.
+	}
+	tmp := a.store.TempName(name, ".part")
+	if err := copyFile(e.Path, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return false, xerrors.Errorf("copy: %w", err)
+	}
+	if err := a.store.Replace(tmp, name); err != nil {
+		return false, err
+	}
+	if a.opt.Relink == "move" {
+		if err := os.Remove(e.Path); err != nil {
+			return false, xerrors.Errorf("remove: %w", err)
+		}
+	}
+	log.Info("Relinked", zap.String("mode", a.opt.Relink), zap.String("to", name))
+	a.indexFile(profile, f, name)
+	return true, nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+)
+
+// exitInterrupted is exit code of run interrupted by user, same as shells
+// use for SIGINT.
+const exitInterrupted = 130
+
+// interruptedError is returned by run interrupted by user, reporting
+// partial progress.
+type interruptedError struct {
+	Completed int
+	Total     int
+}
+
+func (e *interruptedError) Error() string {
+	return trf("run interrupted: %d of %d completed", e.Completed, e.Total)
+}
+
+func (e *interruptedError) Unwrap() error {
+	return context.Canceled
+}
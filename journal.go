@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// Journaled operations.
+const (
+	// journalUpload is upload of gif, which is sent to "Saved Messages",
+	// saved to saved gifs and then revoked.
+	journalUpload = "upload"
+	// journalRemove is removal of downloaded gif from saved gifs.
+	journalRemove = "remove"
+)
+
+// journalEntry is single record of write-ahead journal.
+//
+// Operation is started by entry with Op and committed by entry with same
+// Seq and Commit set.
+type journalEntry struct {
+	Seq    int64  `json:"seq"`
+	Op     string `json:"op,omitempty"`
+	Commit bool   `json:"commit,omitempty"`
+	// Profile of account operation is performed with.
+	Profile string `json:"profile,omitempty"`
+	// Document of operation.
+	DocID         int64  `json:"doc_id,omitempty"`
+	AccessHash    int64  `json:"access_hash,omitempty"`
+	FileReference []byte `json:"file_reference,omitempty"`
+	// MessageID is ID of upload buffer message.
+	MessageID int    `json:"message_id,omitempty"`
+	Name      string `json:"name,omitempty"`
+}
+
+// Doc returns input document of entry.
+func (e journalEntry) Doc() *tg.Document {
+	return &tg.Document{ID: e.DocID, AccessHash: e.AccessHash, FileReference: e.FileReference}
+}
+
+// journal is append-only write-ahead journal of multi-step operations, so
+// operation interrupted by crash is completed on next run.
+type journal struct {
+	store storage
+	path  string
+
+	mux sync.Mutex
+	seq int64
+}
+
+// readJournal returns operations of journal at path that were not
+// committed.
+func readJournal(path string) ([]journalEntry, int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var (
+		seq     int64
+		order   []int64
+		pending = map[int64]journalEntry{}
+	)
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e journalEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			// Last line can be partially written by crash.
+			continue
+		}
+		if e.Seq > seq {
+			seq = e.Seq
+		}
+		if e.Commit {
+			delete(pending, e.Seq)
+			continue
+		}
+		if _, ok := pending[e.Seq]; !ok {
+			order = append(order, e.Seq)
+		}
+		pending[e.Seq] = e
+	}
+	if err := s.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var entries []journalEntry
+	for _, id := range order {
+		if e, ok := pending[id]; ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, seq, nil
+}
+
+// append writes entry to journal, syncing it to disk.
+func (j *journal) append(e journalEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := j.store.Append(j.path, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Begin records start of operation, returning its sequence number.
+func (j *journal) Begin(e journalEntry) (int64, error) {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	j.seq++
+	e.Seq = j.seq
+	e.Commit = false
+	return e.Seq, j.append(e)
+}
+
+// Update records progress of operation started with seq, replacing its
+// entry.
+func (j *journal) Update(seq int64, e journalEntry) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	e.Seq = seq
+	e.Commit = false
+	return j.append(e)
+}
+
+// Commit records completion of operation started with seq.
+func (j *journal) Commit(seq int64) error {
+	j.mux.Lock()
+	defer j.mux.Unlock()
+	return j.append(journalEntry{Seq: seq, Commit: true})
+}
+
+// openJournal opens journal of output directory, completing operations
+// interrupted on previous run.
+func (a *app) openJournal(ctx context.Context) (*journal, error) {
+	if err := a.store.MkdirAll(a.opt.Out, 0o750); err != nil {
+		return nil, xerrors.Errorf("mkdir: %w", err)
+	}
+	path := filepath.Join(a.opt.Out, ".journal")
+	pending, seq, err := readJournal(path)
+	if err != nil {
+		return nil, xerrors.Errorf("read: %w", err)
+	}
+	for _, e := range pending {
+		a.log.Info("Recovering interrupted operation",
+			zap.String("op", e.Op),
+			zap.Int64("id", e.DocID),
+			zap.String("name", e.Name),
+		)
+		if err := a.recoverOperation(ctx, e); err != nil {
+			// Dropping operation, so it doesn't block every next run.
+			a.log.Warn("Failed to recover interrupted operation, dropping it",
+				zap.String("op", e.Op),
+				zap.Int64("id", e.DocID),
+				zap.Int("message_id", e.MessageID),
+				zap.String("name", e.Name),
+				zap.Error(err),
+			)
+		}
+	}
+
+	// Compacting journal, as all operations are either complete or dropped.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &journal{store: a.store, path: path, seq: seq}, nil
+}
+
+// recoverOperation completes interrupted operation e.
+func (a *app) recoverOperation(ctx context.Context, e journalEntry) error {
+	api := a.api
+	for _, acc := range a.accounts {
+		if acc.Profile == e.Profile {
+			api = acc.API
+		}
+	}
+
+	switch e.Op {
+	case journalUpload:
+		if e.MessageID == 0 {
+			// Either not sent, or ID of sent message is unknown.
+			return nil
+		}
+		// Rolling forward, saving gif if possible, as it was uploaded.
+		if e.DocID != 0 {
+			if err := saveGif(ctx, api, e.Doc(), false); err != nil {
+				a.log.Warn("Failed to save uploaded gif", zap.String("name", e.Name), zap.Error(err))
+			}
+		}
+		_, err := message.NewSender(api).Self().Revoke().Messages(ctx, e.MessageID)
+		return err
+	case journalRemove:
+		if _, err := os.Stat(e.Name); err != nil {
+			// Not downloaded, so not removing.
+			return nil
+		}
+		return saveGif(ctx, api, e.Doc(), true)
+	default:
+		return xerrors.Errorf("unknown operation %q", e.Op)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"golang.org/x/xerrors"
+)
+
+func TestOpenJournalRecover(t *testing.T) {
+	for _, tt := range []struct {
+		Name string
+		// Err is error of revoking upload buffer message.
+		Err error
+	}{
+		{Name: "OK"},
+		{Name: "Failed", Err: xerrors.New("MESSAGE_ID_INVALID")},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			var (
+				saved   int64
+				revoked []int
+			)
+			m := newMockInvoker()
+			m.On(tg.MessagesSaveGifRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+				saved = req.(*tg.MessagesSaveGifRequest).ID.(*tg.InputDocument).ID
+				return &tg.BoolTrue{}, nil
+			})
+			m.On(tg.MessagesDeleteMessagesRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+				revoked = append(revoked, req.(*tg.MessagesDeleteMessagesRequest).ID...)
+				if tt.Err != nil {
+					return nil, tt.Err
+				}
+				return &tg.MessagesAffectedMessages{}, nil
+			})
+			a := newTestApp(t, m)
+			a.api = tg.NewClient(m)
+			if err := os.MkdirAll(a.opt.Out, 0o750); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(a.opt.Out, ".journal")
+			prev := &journal{store: a.store, path: path}
+			if _, err := prev.Begin(journalEntry{
+				Op:         journalUpload,
+				DocID:      1,
+				AccessHash: 1,
+				MessageID:  10,
+				Name:       "gif.mp4",
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			j, err := a.openJournal(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if saved != 1 {
+				t.Errorf("Saved %d", saved)
+			}
+			if len(revoked) != 1 || revoked[0] != 10 {
+				t.Errorf("Revoked %v", revoked)
+			}
+			pending, _, err := readJournal(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pending) != 0 {
+				t.Errorf("Pending operations %v", pending)
+			}
+			// Sequence continues after recovered operations.
+			if seq, err := j.Begin(journalEntry{Op: journalRemove}); err != nil {
+				t.Fatal(err)
+			} else if seq != 2 {
+				t.Errorf("Sequence %d", seq)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// listHeader is header of saved gifs CSV manifest.
+var listHeader = []string{"id", "date", "size", "duration", "width", "height", "mime", "path", "color"}
+
+// listEntry is single saved gif in list.
+type listEntry struct {
+	Meta metadata
+	// Path is local path of gif, empty if not downloaded.
+	Path string
+}
+
+// record returns CSV record of entry.
+func (e listEntry) record() []string {
+	return []string{
+		strconv.FormatInt(e.Meta.ID, 10),
+		e.Meta.Date.UTC().Format(time.RFC3339),
+		strconv.Itoa(e.Meta.Size),
+		strconv.FormatFloat(e.Meta.Duration, 'f', -1, 64),
+		strconv.Itoa(e.Meta.Width),
+		strconv.Itoa(e.Meta.Height),
+		e.Meta.MIME,
+		e.Path,
+		e.Meta.Color,
+	}
+}
+
+// savedGifsList returns entries of all saved gifs, most recently saved
+// first.
+func (a *app) savedGifsList(ctx context.Context) ([]listEntry, error) {
+	docs, err := listSavedGifs(ctx, a.api)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]listEntry, 0, len(docs))
+	for _, doc := range docs {
+		e := listEntry{Meta: documentMetadata("gifs", doc)}
+		name := filepath.Join(a.opt.Out, fmt.Sprintf("%d.mp4", doc.ID))
+		if _, err := os.Stat(name); err == nil {
+			e.Path = name
+			if e.Meta.Duration == 0 || e.Meta.Width == 0 {
+				if info, err := probeMP4(name); err == nil {
+					e.Meta.Duration = info.Duration
+					e.Meta.Width, e.Meta.Height = info.Width, info.Height
+				}
+			}
+			if e.Meta.Color == "" && a.opt.FrameColor {
+				e.Meta.Color, _ = frameColor(ctx, name)
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// writeListCSV writes entries as CSV with header.
+func writeListCSV(w io.Writer, entries []listEntry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(listHeader); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := cw.Write(e.record()); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeListTable writes entries as human-readable table.
+func writeListTable(tw table, entries []listEntry) error {
+	_, _ = fmt.Fprintln(tw, "ID\tDATE\tSIZE\tDURATION\tDIMENSIONS\tPATH")
+	for _, e := range entries {
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%d\t%gs\t%dx%d\t%s\n",
+			e.Meta.ID, e.Meta.Date.Format("2006-01-02 15:04"), e.Meta.Size,
+			e.Meta.Duration, e.Meta.Width, e.Meta.Height, e.Path,
+		)
+	}
+	return tw.Flush()
+}
+
+// listCmd lists saved gifs metadata without downloading them.
+func listCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		asCSV  = fs.Bool("csv", false, "write CSV instead of table")
+		output = fs.String("o", "", "output file (default is stdout)")
+	)
+	return func(ctx context.Context, a *app) error {
+		if *output != "" && a.opt.ReadOnly {
+			return xerrors.New("output file is not supported in read-only mode")
+		}
+		entries, err := a.savedGifsList(ctx)
+		if err != nil {
+			return err
+		}
+
+		write := func(w io.Writer, entries []listEntry) error {
+			return writeListTable(newTable(w, a.opt.Plain), entries)
+		}
+		if *asCSV {
+			write = writeListCSV
+		}
+		if *output == "" {
+			return write(os.Stdout, entries)
+		}
+
+		f, err := a.store.Create(*output, 0o666)
+		if err != nil {
+			return xerrors.Errorf("create: %w", err)
+		}
+		if err := write(f, entries); err != nil {
+			_ = f.Close()
+			return xerrors.Errorf("write: %w", err)
+		}
+		return f.Close()
+	}
+}
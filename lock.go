@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// runLock is lock file preventing concurrent runs using same session or
+// output directory.
+type runLock struct {
+	path string
+}
+
+// lockAlive reports whether lock file content belongs to running process.
+func lockAlive(content string) bool {
+	fields := strings.Fields(content)
+	if len(fields) < 2 {
+		return true
+	}
+	if host, err := os.Hostname(); err != nil || host != fields[1] {
+		// Can't check process on other host.
+		return true
+	}
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return true
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return p.Signal(syscall.Signal(0)) == nil
+}
+
+// acquireLock creates lock file at path, removing stale one left by dead
+// process or, if force is set, any one.
+func acquireLock(path string, force bool) (*runLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, xerrors.Errorf("mkdir: %w", err)
+	}
+	host, _ := os.Hostname()
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d %s\n", os.Getpid(), host)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(path)
+				return nil, err
+			}
+			return &runLock{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if !force && lockAlive(string(content)) {
+			return nil, xerrors.Errorf("%s is locked by process %q, use --force-unlock if it is not running",
+				path, strings.TrimSpace(string(content)),
+			)
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, xerrors.Errorf("%s: failed to acquire lock", path)
+}
+
+// Release removes lock file.
+func (l *runLock) Release() {
+	_ = os.Remove(l.path)
+}
+
+// sessionLockPath returns path of lock file of profile session.
+func sessionLockPath(profile string) (string, error) {
+	if profile != "" {
+		dir, err := profileDir(profile)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(dir, "lock"), nil
+	}
+	if name, ok := os.LookupEnv("SESSION_FILE"); ok {
+		return name + ".lock", nil
+	}
+	dir, err := profileDir("")
+	if err != nil {
+		return "", err
+	}
+	// Default session is stored in session directory itself.
+	return filepath.Join(filepath.Dir(dir), "session.lock"), nil
+}
+
+// lockRun acquires locks of output directory and sessions of profiles,
+// returning function releasing them. Read-only runs take no locks.
+func (a *app) lockRun(profiles []string) (func(), error) {
+	var locks []*runLock
+	release := func() {
+		for _, l := range locks {
+			l.Release()
+		}
+	}
+
+	if a.opt.ReadOnly {
+		// Neither session nor output is changed, so both can be shared
+		// with other runs.
+		return release, nil
+	}
+	// Creating output directory here, so it gets mode of output and not
+	// of session directory.
+	if err := a.store.MkdirAll(a.opt.Out, 0o750); err != nil {
+		return nil, xerrors.Errorf("mkdir: %w", err)
+	}
+	paths := []string{filepath.Join(a.opt.Out, ".lock")}
+	for _, profile := range profiles {
+		path, err := sessionLockPath(profile)
+		if err != nil {
+			return nil, xerrors.Errorf("profile %q: %w", profile, err)
+		}
+		paths = append(paths, path)
+	}
+	for _, path := range paths {
+		l, err := acquireLock(path, a.opt.ForceUnlock)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		locks = append(locks, l)
+	}
+	return release, nil
+}
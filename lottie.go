@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// renderLottie renders animated .tgs sticker to GIF or WebM next to it.
+//
+// Rendering is delegated to external Lottie renderer invoked as
+// "<renderer> input.tgs output.gif" (e.g. lottie_convert.py from
+// python-lottie). WebM is produced from rendered GIF by ffmpeg.
+func renderLottie(ctx context.Context, store storage, renderer, format, in string) (string, error) {
+	base := strings.TrimSuffix(in, filepath.Ext(in))
+	gif := base + ".gif"
+	tmp := store.TempName(gif, ".tmp.gif")
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, renderer, in, tmp)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		_ = os.Remove(tmp)
+		return "", xerrors.Errorf("%s: %w: %s", renderer, err, strings.TrimSpace(stderr.String()))
+	}
+
+	switch format {
+	case "gif":
+		if err := store.Replace(tmp, gif); err != nil {
+			return "", err
+		}
+		return gif, nil
+	case "webm":
+		defer func() { _ = os.Remove(tmp) }()
+		out := base + ".webm"
+		if err := convert(ctx, store, rendition{Format: "webm"}, tmp, out); err != nil {
+			return "", err
+		}
+		return out, nil
+	default:
+		_ = os.Remove(tmp)
+		return "", xerrors.Errorf("unsupported format %q", format)
+	}
+}
@@ -7,29 +7,43 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/gotd/contrib/middleware/ratelimit"
+	"github.com/gotd/td/clock"
 	"github.com/gotd/td/telegram"
 	"github.com/gotd/td/telegram/auth"
-	"github.com/gotd/td/telegram/downloader"
-	"github.com/gotd/td/telegram/query/hasher"
 	"github.com/gotd/td/tg"
-	"go.uber.org/atomic"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 	"golang.org/x/crypto/ssh/terminal"
-	"golang.org/x/sync/errgroup"
-	"golang.org/x/time/rate"
 	"golang.org/x/xerrors"
 )
 
+// prompter asks user for input.
+type prompter interface {
+	Prompt(text string) (string, error)
+}
+
+// terminalPrompter implements prompter reading input from terminal.
+type terminalPrompter struct{}
+
+// Prompt prints text and reads single line from terminal.
+func (terminalPrompter) Prompt(text string) (string, error) {
+	fmt.Print(text)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
 // terminalAuth implements auth.UserAuthenticator prompting the terminal for
 // input.
-type terminalAuth struct{}
+type terminalAuth struct {
+	prompt prompter
+}
 
 func (terminalAuth) SignUp(ctx context.Context) (auth.UserInfo, error) {
 	return auth.UserInfo{}, xerrors.New("not implemented")
@@ -39,26 +53,16 @@ func (terminalAuth) AcceptTermsOfService(ctx context.Context, tos tg.HelpTermsOf
 	return &auth.SignUpRequired{TermsOfService: tos}
 }
 
-func (terminalAuth) Code(ctx context.Context, sentCode *tg.AuthSentCode) (string, error) {
-	fmt.Print("Enter code: ")
-	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	if err != nil {
-		return "", err
-	}
-	return strings.TrimSpace(code), nil
+func (t terminalAuth) Code(ctx context.Context, sentCode *tg.AuthSentCode) (string, error) {
+	return t.prompt.Prompt(tr("Enter code: "))
 }
 
-func (terminalAuth) Phone(_ context.Context) (string, error) {
-	fmt.Print("Enter phone: ")
-	code, err := bufio.NewReader(os.Stdin).ReadString('\n')
-	if err != nil {
-		return "", err
-	}
-	return strings.TrimSpace(code), nil
+func (t terminalAuth) Phone(_ context.Context) (string, error) {
+	return t.prompt.Prompt(tr("Enter phone: "))
 }
 
 func (terminalAuth) Password(_ context.Context) (string, error) {
-	fmt.Print("Enter 2FA password: ")
+	fmt.Print(tr("Enter 2FA password: "))
 	bytePwd, err := terminal.ReadPassword(syscall.Stdin)
 	if err != nil {
 		return "", err
@@ -66,183 +70,632 @@ func (terminalAuth) Password(_ context.Context) (string, error) {
 	return strings.TrimSpace(string(bytePwd)), nil
 }
 
+// options are flags shared by all commands.
+type options struct {
+	Out       string
+	Input     string
+	Jobs      int
+	Remove    bool
+	Rate      time.Duration
+	RateBurst int
+	Takeout   bool
+	Profiles  stringsFlag
+	// Convert is format to convert downloaded videos to, empty disables
+	// conversion.
+	Convert        string
+	ConvertJobs    int
+	ConvertReplace bool
+	ConvertMaxDim  int
+	ConvertQuality int
+	ConvertFPS     int
+	ConvertPlays   int
+	ConvertScale   int
+	ConvertCRF     int
+	// TargetSize is maximum size of mp4 renditions.
+	TargetSize byteSize
+	// Posters enables extraction of poster frame of downloaded videos.
+	Posters      bool
+	PosterFrame  string
+	PosterFormat string
+	// Provenance enables embedding of document origin into downloaded mp4.
+	Provenance bool
+	// HWAccel is hardware encoder mode of mp4 conversions.
+	HWAccel string
+	// Previews is length of preview clips, zero disables them.
+	Previews time.Duration
+	// Sprite is grid of sprite sheets, zero disables them.
+	Sprite      spriteGrid
+	SpriteWidth int
+	// WebmToMP4 enables conversion of downloaded webm videos to mp4.
+	WebmToMP4      bool
+	WebmBackground string
+	// Watermark is image overlaid on uploaded gifs.
+	Watermark         string
+	WatermarkPosition string
+	// MaxRetries, RetryInitial and RetryMax configure retries of failed
+	// downloads of error classes listed in RetryOn.
+	MaxRetries   int
+	RetryInitial time.Duration
+	RetryMax     time.Duration
+	RetryOn      string
+	// TransferWindow is daily period of bulk transfers, e.g. 01:00-07:00.
+	TransferWindow string
+	// MonthlyQuota limits bytes transferred by profile per month, zero is
+	// unlimited.
+	MonthlyQuota byteSize
+	// PreviousRun is action for checkpoint of run which exited abnormally:
+	// prompt, resume, restart or inspect.
+	PreviousRun string
+	// Lang is language of prompts and messages, detected from LANG if
+	// empty.
+	Lang string
+	// Plain disables alignment and decorations of output.
+	Plain bool
+	// Trace enables logging of every RPC call.
+	Trace bool
+	// Network is preferred IP version of DC addresses, stored per profile.
+	Network string
+	// ReadOnly rejects all requests changing account state.
+	ReadOnly bool
+	// ForceUnlock removes locks of other runs.
+	ForceUnlock bool
+	// Record and Replay are fixture files to record RPC calls to or to
+	// answer them from instead of connecting to Telegram.
+	Record string
+	Replay string
+	// TmpDir is directory of temporary files, e.g. on fast disk.
+	TmpDir string
+	// GCAge is age of temporary files of interrupted runs removed at start,
+	// zero disables removal. Read-only runs and runs with output to system
+	// temporary directory never remove them.
+	GCAge time.Duration
+	// Chmod and DirMode are octal modes of written files and directories,
+	// Owner is their "user[:group]".
+	Chmod   string
+	DirMode string
+	Owner   string
+	// Collision is strategy of resolving file name collisions.
+	Collision string
+	// Aspect and MinResolution filter downloaded files by dimensions.
+	Aspect        string
+	MinResolution string
+	// Match and MatchName filter downloaded files by globs of original
+	// file name or MIME type.
+	Match     string
+	MatchName string
+	// Validate enables integrity checks of downloaded and uploaded mp4.
+	Validate bool
+	// XMP enables writing XMP sidecars for digital asset managers.
+	XMP bool
+	// FrameColor enables computing color of gifs without inlined thumbnail
+	// from first frame.
+	FrameColor bool
+	// Relink copies or moves files found by download index to output
+	// directory, if set.
+	Relink string
+	// Xattr enables storing document ID, access hash and date in extended
+	// attributes.
+	Xattr bool
+}
+
+// register registers options in fs using current values as defaults, so
+// command flag sets can re-declare global flags without resetting them.
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.Out, "out", o.Out, "output directory")
+	fs.StringVar(&o.Input, "input", o.Input, "input directory for uploads")
+	fs.IntVar(&o.Jobs, "j", o.Jobs, "maximum concurrent download jobs")
+	fs.BoolVar(&o.Remove, "rm", o.Remove, "remove downloaded gifs")
+	fs.DurationVar(&o.Rate, "rate", o.Rate, "limit maximum rpc call rate")
+	fs.IntVar(&o.RateBurst, "rate-burst", o.RateBurst, "limit rpc call burst")
+	fs.BoolVar(&o.Takeout, "takeout", o.Takeout, "run export within takeout session")
+	fs.StringVar(&o.Convert, "convert", o.Convert, "convert downloaded videos to format (gif, webp, apng, mp4)")
+	fs.IntVar(&o.ConvertJobs, "convert-jobs", o.ConvertJobs, "maximum concurrent conversion jobs")
+	fs.BoolVar(&o.ConvertReplace, "convert-replace", o.ConvertReplace, "remove downloaded video after conversion")
+	fs.IntVar(&o.ConvertMaxDim, "convert-max-dim", o.ConvertMaxDim, "limit larger dimension of converted renditions")
+	fs.IntVar(&o.ConvertQuality, "convert-quality", o.ConvertQuality, "webp quality from 1 to 100 (default 75), for gif scales palette size")
+	fs.IntVar(&o.ConvertFPS, "convert-fps", o.ConvertFPS, "frame rate of converted renditions (default is source frame rate)")
+	fs.IntVar(&o.ConvertPlays, "convert-loop", o.ConvertPlays, "number of times converted animation is played, 0 loops forever")
+	fs.IntVar(&o.ConvertScale, "convert-scale", o.ConvertScale, "width of converted renditions, not upscaling (default is source width)")
+	fs.IntVar(&o.ConvertCRF, "convert-crf", o.ConvertCRF, "constant rate factor of mp4 renditions (default 23)")
+	fs.Var(&o.TargetSize, "target-size", "re-encode mp4 videos exceeding size to fit into it, e.g. 3MB")
+	fs.BoolVar(&o.Posters, "posters", o.Posters, "extract poster frame of downloaded videos")
+	fs.StringVar(&o.PosterFrame, "poster-frame", o.PosterFrame, "poster frame: first or middle")
+	fs.StringVar(&o.PosterFormat, "poster-format", o.PosterFormat, "poster format: jpg or png")
+	fs.BoolVar(&o.Provenance, "provenance", o.Provenance, "embed document ID, date and account into downloaded mp4 metadata")
+	fs.StringVar(&o.HWAccel, "hwaccel", o.HWAccel, "hardware mp4 encoder: none, auto, nvenc, vaapi or videotoolbox")
+	fs.DurationVar(&o.Previews, "previews", o.Previews, "render low-res preview clips of given length, e.g. 3s")
+	fs.Var(&o.Sprite, "spritesheet", "render sprite sheet of frames grid with JSON frame map, e.g. 4x4")
+	fs.IntVar(&o.SpriteWidth, "sprite-width", o.SpriteWidth, "width of sprite sheet frame")
+	fs.BoolVar(&o.WebmToMP4, "webm-to-mp4", o.WebmToMP4, "convert downloaded webm videos to H.264 mp4")
+	fs.StringVar(&o.WebmBackground, "webm-background", o.WebmBackground, "background color of transparent webm converted to mp4")
+	fs.StringVar(&o.Watermark, "watermark", o.Watermark, "overlay image on uploaded gifs")
+	fs.StringVar(&o.WatermarkPosition, "position", o.WatermarkPosition, "watermark position: tl, tr, bl, br or c")
+	fs.IntVar(&o.MaxRetries, "max-retries", o.MaxRetries, "maximum retries of failed download")
+	fs.DurationVar(&o.RetryInitial, "retry-initial", o.RetryInitial, "delay before first retry, doubled on each next one")
+	fs.DurationVar(&o.RetryMax, "retry-max", o.RetryMax, "maximum delay between retries")
+	fs.StringVar(&o.RetryOn, "retry-on", o.RetryOn, "comma-separated error classes to retry: network, server, reference, rpc")
+	fs.StringVar(&o.TransferWindow, "transfer-window", o.TransferWindow, "local time period of downloads and uploads, e.g. 01:00-07:00, holding them otherwise")
+	fs.Var(&o.MonthlyQuota, "monthly-quota", "pause downloads and uploads of profile after transferring size in month, e.g. 50GB")
+	fs.StringVar(&o.PreviousRun, "previous-run", o.PreviousRun, "action for unfinished previous run: prompt, resume, restart or inspect")
+	fs.StringVar(&o.Lang, "lang", o.Lang, "language of prompts and messages: en or ru (default from LANG)")
+	fs.BoolVar(&o.Plain, "plain", o.Plain, "plain line-per-event output without alignment, timestamps or decorations, e.g. for screen readers")
+	fs.BoolVar(&o.Trace, "trace", o.Trace, "log every Telegram API call with sizes, latency and error, without contents")
+	fs.StringVar(&o.Network, "network", o.Network, "prefer DC addresses of ipv4 or ipv6, remembered per profile")
+	fs.BoolVar(&o.ReadOnly, "read-only", o.ReadOnly, "never change account or session, e.g. for list or stats alongside other tools")
+	fs.BoolVar(&o.ForceUnlock, "force-unlock", o.ForceUnlock, "remove locks of session and output directory left by other run")
+	fs.StringVar(&o.Record, "record", o.Record, "record Telegram API calls to fixture file")
+	fs.StringVar(&o.Replay, "replay", o.Replay, "answer Telegram API calls from recorded fixture file instead of connecting")
+	fs.DurationVar(&o.GCAge, "gc-age", o.GCAge, "remove temporary files of interrupted runs older than duration at start (zero disables)")
+	fs.StringVar(&o.Chmod, "chmod", o.Chmod, "octal mode of written files, e.g. 0644")
+	fs.StringVar(&o.DirMode, "dirmode", o.DirMode, "octal mode of created directories, e.g. 0755")
+	fs.StringVar(&o.Owner, "owner", o.Owner, "user[:group] owning written files and directories, names or IDs")
+	fs.StringVar(&o.TmpDir, "tmp-dir", o.TmpDir, "directory of partial downloads and conversion scratch files (default is next to output)")
+	fs.StringVar(&o.Collision, "collision", o.Collision, "file name collision strategy: suffix, hash, overwrite or error")
+	fs.StringVar(&o.Aspect, "aspect", o.Aspect, "download only media of aspect ratio, e.g. 16:9")
+	fs.StringVar(&o.MinResolution, "min-resolution", o.MinResolution, "download only media with smaller side of at least, e.g. 480p")
+	fs.StringVar(&o.Match, "match", o.Match, "download only media with original file name or MIME type matching glob, e.g. '*.webm' or 'video/*'")
+	fs.StringVar(&o.MatchName, "match-name", o.MatchName, "download only media with original file name matching glob, e.g. 'cat*'")
+	fs.BoolVar(&o.Validate, "validate", o.Validate, "check integrity of downloaded and uploaded mp4 files")
+	fs.BoolVar(&o.XMP, "xmp", o.XMP, "write XMP sidecars with date, title and keywords")
+	fs.BoolVar(&o.FrameColor, "frame-color", o.FrameColor, "compute color of gifs without inlined thumbnail from first frame by ffmpeg")
+	fs.StringVar(&o.Relink, "relink", o.Relink, "copy or move files downloaded to other path (e.g. other -out) into output instead of skipping them: copy or move")
+	fs.BoolVar(&o.Xattr, "xattr", o.Xattr, "store document ID, access hash and date in extended attributes of downloaded files")
+	fs.Var(&o.Profiles, "profile", "named profile (session) to use, can be repeated if command supports it")
+}
+
+// app is shared state passed to command handlers.
+type app struct {
+	opt options
+	log *zap.Logger
+	// api is client of first account, nil for offline commands.
+	api *tg.Client
+	// accounts are all connected accounts.
+	accounts []account
+	// filter selects files to download.
+	filter mediaFilter
+	// clock is time source, e.g. of delays between requests.
+	clock clock.Clock
+	// prompt asks user for input.
+	prompt prompter
+	// store writes output files.
+	store storage
+	// invoker returns invoker answering RPC calls of profile instead of
+	// connecting to Telegram, if set, e.g. mock one in tests.
+	invoker func(profile string) tg.Invoker
+	// recorder records RPC calls to fixture, if requested.
+	recorder *recorder
+	// journal records multi-step operations, if opened by command.
+	journal *journal
+	// checkpoint records files completed by run.
+	checkpoint *checkpoint
+	// retryOn are error classes of retried downloads.
+	retryOn map[string]struct{}
+	// window is daily period of downloads and uploads.
+	window transferWindow
+	// index maps document IDs to downloaded files.
+	index downloadIndex
+	// transfers tracks transferred bytes of profiles.
+	transfers transfers
+	// names resolves collisions of file names.
+	names *collisions
+	// encoder is hardware h264 encoder for conversions, empty for software
+	// one.
+	encoder string
+}
+
+// command describes single telegifdl subcommand.
+type command struct {
+	// Usage is short command description.
+	Usage string
+	// Offline commands are executed without connecting to Telegram.
+	Offline bool
+	// Takeout commands can be executed within takeout session.
+	Takeout bool
+	// MultiProfile commands can use several profiles at once.
+	MultiProfile bool
+	// ReadOnly commands write nothing to output or session directory, so
+	// they can be executed in read-only mode.
+	ReadOnly bool
+	// Online reports whether Offline command needs connection with
+	// positional arguments, if set.
+	Online func(args []string) bool
+	// Setup registers command-specific flags and returns command handler.
+	Setup func(fs *flag.FlagSet) func(ctx context.Context, a *app) error
+}
+
+// commands is list of all available subcommands, "download" is default one.
+var commands = map[string]command{
+	"download": {
+		Usage:        "download saved gifs (default)",
+		Setup:        downloadCmd,
+		MultiProfile: true,
+	},
+	"stickers": {
+		Usage: "download stickers: recent, faved, installed, set <shortname>",
+		Setup: stickersCmd,
+	},
+	"photos": {
+		Usage:   "download profile photos of current or provided user",
+		Setup:   photosCmd,
+		Takeout: true,
+	},
+	"saved-messages": {
+		Usage:   "download all media from Saved Messages",
+		Setup:   savedMessagesCmd,
+		Takeout: true,
+	},
+	"export-chat": {
+		Usage:   "download media of selected kinds from chat",
+		Setup:   exportChatCmd,
+		Takeout: true,
+	},
+	"search-gifs": {
+		Usage: "search gifs via inline bot, download or save selected ones",
+		Setup: searchGifsCmd,
+	},
+	"forward": {
+		Usage: "send all saved gifs to chat",
+		Setup: forwardCmd,
+	},
+	"backup-channel": {
+		Usage: "copy saved gifs to private backup channel",
+		Setup: backupChannelCmd,
+	},
+	"restore-channel": {
+		Usage: "save gifs from backup channel to saved gifs",
+		Setup: restoreChannelCmd,
+	},
+	"list": {
+		Usage:    "list saved gifs metadata",
+		Setup:    listCmd,
+		ReadOnly: true,
+	},
+	"reorder": {
+		Usage: "re-save saved gifs in manifest order",
+		Setup: reorderCmd,
+	},
+	"bump": {
+		Usage: "move saved gifs to the top of gif panel",
+		Setup: bumpCmd,
+	},
+	"dedupe-remote": {
+		Usage: "find duplicate saved gifs and unsave them",
+		Setup: dedupeRemoteCmd,
+	},
+	"stats": {
+		Usage:    "print saved gifs stats",
+		Setup:    statsCmd,
+		ReadOnly: true,
+	},
+	"wallpapers": {
+		Usage: "download installed chat wallpapers and theme files",
+		Setup: wallpapersCmd,
+	},
+	"dedupe": {
+		Usage:   "find duplicate downloaded gifs, optionally visually similar ones",
+		Offline: true,
+		Setup:   dedupeCmd,
+	},
+	"compile": {
+		Usage:   "concatenate downloaded gifs into single video",
+		Offline: true,
+		Setup:   compileCmd,
+	},
+	"self-update": {
+		Usage:   "replace binary with latest release",
+		Offline: true,
+		Setup:   selfUpdateCmd,
+	},
+	"mirror": {
+		Usage:        "copy saved gifs of first profile to second one",
+		Setup:        mirrorCmd,
+		MultiProfile: true,
+	},
+	"gc": {
+		Usage:   "remove stale partial and temporary files of interrupted runs",
+		Setup:   gcCmd,
+		Offline: true,
+	},
+	"diff": {
+		Usage:    "compare manifests, manifest and output directory, or output directory and account",
+		Setup:    diffCmd,
+		Offline:  true,
+		Online:   diffOnline,
+		ReadOnly: true,
+	},
+	"export": {
+		Usage:   "convert downloaded gifs to platform-constrained renditions",
+		Offline: true,
+		Setup:   exportCmd,
+	},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	_, _ = fmt.Fprint(out, trf("Usage: %s [flags] [command] [command flags]\n\nCommands:\n", os.Args[0]))
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		_, _ = fmt.Fprintf(out, "  %-16s %s\n", name, tr(commands[name].Usage))
+	}
+	_, _ = fmt.Fprintln(out, tr("\nFlags:"))
+	flag.PrintDefaults()
+}
+
+// parseInterspersed parses args allowing command flags to follow positional
+// arguments, e.g. "export-chat @peer --types gif". Positional arguments are
+// available as fs.Args() after parsing.
+func parseInterspersed(fs *flag.FlagSet, args []string) error {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return fs.Parse(append([]string{"--"}, positional...))
+}
+
+// defaultOptions returns options with default values of flags.
+func defaultOptions() options {
+	return options{
+		Out:               os.TempDir(),
+		Jobs:              3,
+		Rate:              time.Millisecond * 100,
+		RateBurst:         3,
+		ConvertJobs:       2,
+		PosterFrame:       "first",
+		PosterFormat:      "jpg",
+		Validate:          true,
+		SpriteWidth:       160,
+		WatermarkPosition: "br",
+		Collision:         "suffix",
+		MaxRetries:        4,
+		RetryInitial:      time.Second,
+		RetryMax:          time.Minute,
+		RetryOn:           "network,server,reference,rpc",
+		PreviousRun:       "prompt",
+		GCAge:             24 * time.Hour,
+		WebmBackground:    "white",
+	}
+}
+
 func run(ctx context.Context) error {
-	var (
-		outputDir = flag.String("out", os.TempDir(), "output directory")
-		inputDir  = flag.String("input", "", "input directory for uploads")
-		jobs      = flag.Int("j", 3, "maximum concurrent download jobs")
-		remove    = flag.Bool("rm", false, "remove downloaded gifs")
-		rateLimit = flag.Duration("rate", time.Millisecond*100, "limit maximum rpc call rate")
-		rateBurst = flag.Int("rate-burst", 3, "limit rpc call burst")
-	)
+	a := &app{opt: defaultOptions()}
+	a.opt.register(flag.CommandLine)
+	flag.Usage = usage
 	flag.Parse()
+	if err := setLang(a.opt.Lang); err != nil {
+		return err
+	}
 
-	log, _ := zap.NewDevelopment(zap.IncreaseLevel(zapcore.InfoLevel), zap.AddStacktrace(zapcore.FatalLevel))
+	name := "download"
+	if flag.NArg() > 0 {
+		name = flag.Arg(0)
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		flag.Usage()
+		return xerrors.Errorf(tr("unknown command %q"), name)
+	}
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	a.opt.register(fs)
+	handler := cmd.Setup(fs)
+	if flag.NArg() > 0 {
+		if err := parseInterspersed(fs, flag.Args()[1:]); err != nil {
+			return err
+		}
+		if err := setLang(a.opt.Lang); err != nil {
+			return err
+		}
+	}
+	if cmd.Online != nil && cmd.Online(fs.Args()) {
+		cmd.Offline = false
+	}
+
+	log := newLogger(a.opt.Plain)
 	defer func() { _ = log.Sync() }()
+	a.log = log
+	a.clock = clock.System
+	a.prompt = terminalPrompter{}
 
-	// Initializing client from environment.
-	// Available environment variables:
-	// 	APP_ID:         app_id of Telegram app.
-	// 	APP_HASH:       app_hash of Telegram app.
-	// 	SESSION_FILE:   path to session file
-	// 	SESSION_DIR:    path to session directory, if SESSION_FILE is not set
-	client, err := telegram.ClientFromEnvironment(telegram.Options{
-		Logger: log,
-		Middlewares: []telegram.Middleware{
-			ratelimit.New(rate.Every(*rateLimit), *rateBurst),
-		},
-	})
+	return a.exec(ctx, name, cmd, handler)
+}
+
+// exec validates options and runs command handler, connecting to Telegram
+// unless command is offline.
+//
+// Dependencies are taken from app, so command can be executed with other
+// clock, prompter, storage, invoker or fixture replaying client. Storage is
+// created from options if not set.
+func (a *app) exec(ctx context.Context, name string, cmd command, handler func(ctx context.Context, a *app) error) error {
+	if flags := a.opt.ffmpegOptions(); len(flags) > 0 && !hasFFmpeg() {
+		// Failing early instead of failing on every file.
+		return xerrors.Errorf("%s: %w", strings.Join(flags, ", "), errNoFFmpeg)
+	}
+	if a.opt.Convert != "" {
+		if _, err := a.convertRendition(); err != nil {
+			return err
+		}
+	}
+	if a.opt.Posters {
+		if err := a.opt.checkPoster(); err != nil {
+			return err
+		}
+	}
+	filter, err := parseMediaFilter(a.opt.Aspect, a.opt.MinResolution, a.opt.Match, a.opt.MatchName)
 	if err != nil {
 		return err
 	}
-
-	// Setting up authentication flow.
-	// Current flow will read phone, code and 2FA password from terminal.
-	flow := auth.NewFlow(terminalAuth{}, auth.SendCodeOptions{})
-
-	// Creating new RPC client.
-	//
-	// The tg.Client is generated from Telegram schema and implements
-	// invocation of all defined Telegram MTProto methods on top of tg.Invoker.
-	// E.g. api.MessagesSendMessage() is messages.sendMessage method.
-	//
-	// The tg.Invoker interface is implemented by client (telegram.Client) and
-	// allows calling any MTProto method, like that:
-	//	Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error
-	api := client.API()
-
-	// Connecting, performing authentication and downloading gifs.
-	return client.Run(ctx, func(ctx context.Context) error {
-		// Perform auth if no session is available.
-		if err := client.Auth().IfNecessary(ctx, flow); err != nil {
-			return xerrors.Errorf("auth: %w", err)
-		}
-
-		if *inputDir != "" {
-			// Handling bulk upload.
-			// Probably we can de-duplicate gifs by some criteria.
-			if err := upload(ctx, log, api, *inputDir); err != nil {
-				return xerrors.Errorf("upload: %w", err)
+	a.filter = filter
+	if _, ok := collisionStrategies[a.opt.Collision]; !ok {
+		return xerrors.Errorf("unknown collision strategy %q", a.opt.Collision)
+	}
+	a.names = &collisions{Strategy: a.opt.Collision}
+	if a.opt.MaxRetries < 0 || a.opt.RetryInitial <= 0 || a.opt.RetryMax < a.opt.RetryInitial {
+		return xerrors.New("invalid retry policy")
+	}
+	retryOn, err := parseRetryOn(a.opt.RetryOn)
+	if err != nil {
+		return err
+	}
+	a.retryOn = retryOn
+	window, err := parseTransferWindow(a.opt.TransferWindow)
+	if err != nil {
+		return err
+	}
+	a.window = window
+	if _, ok := relinkModes[a.opt.Relink]; !ok {
+		return xerrors.Errorf("unknown relink mode %q", a.opt.Relink)
+	}
+	if a.opt.Xattr && !xattrSupported {
+		return errNoXattr
+	}
+	perms, err := parsePermissions(a.opt.Chmod, a.opt.DirMode, a.opt.Owner)
+	if err != nil {
+		return err
+	}
+	if a.opt.Watermark != "" {
+		if _, ok := watermarkPositions[a.opt.WatermarkPosition]; !ok {
+			return xerrors.Errorf("unknown watermark position %q", a.opt.WatermarkPosition)
+		}
+	}
+	if a.opt.Convert != "" || a.opt.Previews > 0 {
+		encoder, err := hwEncoder(ctx, a.opt.HWAccel)
+		if err != nil {
+			return xerrors.Errorf("hwaccel: %w", err)
+		}
+		if encoder != "" {
+			a.log.Info("Using hardware encoder", zap.String("encoder", encoder))
+		}
+		a.encoder = encoder
+	}
+	if a.store == nil {
+		disk := newDiskStorage()
+		disk.Perms = perms
+		if a.opt.TmpDir != "" {
+			cleanup, err := disk.setupScratch(a.opt.TmpDir)
+			if err != nil {
+				return xerrors.Errorf("tmp dir: %w", err)
 			}
+			defer cleanup()
 		}
+		a.store = disk
+	}
+	if a.opt.ReadOnly && (!cmd.ReadOnly || a.opt.Takeout) {
+		// Output is not locked in read-only mode, so concurrent run could
+		// write same files.
+		return xerrors.Errorf("command %q is not supported in read-only mode", name)
+	}
+	if cmd.Offline {
+		return handler(ctx, a)
+	}
+	if a.opt.Takeout && !cmd.Takeout {
+		return xerrors.Errorf("command %q does not support takeout", name)
+	}
 
-		// Processing gifs.
-		gifs := make(chan *tg.Document, *jobs)
-		g, ctx := errgroup.WithContext(ctx)
-		g.Go(func() error {
-			defer close(gifs)
-
-			// Telegram allows up to 200 saved gifs, but only hides exceeding
-			// ones.
-			//
-			// Hasher implements Telegram "pagination" hash calculation and
-			// allows us exhaust all gifs in "rm" mode.
-			h := hasher.Hasher{}
-			for {
-				result, err := api.MessagesGetSavedGifs(ctx, int(h.Sum()))
-				if err != nil {
-					return xerrors.Errorf("get: %w", err)
-				}
-
-				h.Reset()
-				switch result := result.(type) {
-				case *tg.MessagesSavedGifsNotModified:
-					// Done.
-					return nil
-				case *tg.MessagesSavedGifs:
-					log.Info("Got gifs",
-						zap.Int("count", len(result.Gifs)),
-					)
-					if len(result.Gifs) == 0 {
-						// No results.
-						return nil
-					}
-
-					// Processing batch.
-					for _, doc := range result.Gifs {
-						doc, ok := doc.AsNotEmpty()
-						if !ok {
-							continue
-						}
-
-						select {
-						case gifs <- doc:
-							h.Update64(uint64(doc.ID))
-						case <-ctx.Done():
-							return ctx.Err()
-						}
-					}
-				}
-			}
-		})
-
-		var (
-			total      atomic.Int32
-			downloaded atomic.Int32
-		)
-		for j := 0; j < *jobs; j++ {
-			g.Go(func() error {
-				// Process all discovered gifs.
-				d := downloader.NewDownloader()
-				for doc := range gifs {
-					total.Inc()
-					gifPath := filepath.Join(*outputDir, fmt.Sprintf("%d.mp4", doc.ID))
-					log.Info("Got gif",
-						zap.Int64("id", doc.ID),
-						zap.Time("date", time.Unix(int64(doc.Date), 0)),
-						zap.String("path", gifPath),
-					)
-
-					if _, err := os.Stat(gifPath); err == nil {
-						// File exists, skipping.
-						//
-						// Note that we are not completely sure that existing
-						// file is exactly same as this gif (e.g. partial
-						// download), so not removing even with --rm flag.
-						continue
-					}
-
-					// Downloading gif to gifPath.
-					loc := doc.AsInputDocumentFileLocation()
-					if _, err := d.Download(api, loc).ToPath(ctx, gifPath); err != nil {
-						return xerrors.Errorf("download: %w", err)
-					}
-					downloaded.Inc()
-
-					if *remove {
-						log.Info("Removing gif after download",
-							zap.Int64("id", doc.ID),
-							zap.Time("date", time.Unix(int64(doc.Date), 0)),
-						)
-						if _, err := api.MessagesSaveGif(ctx, &tg.MessagesSaveGifRequest{
-							ID:     doc.AsInput(),
-							Unsave: true,
-						}); err != nil {
-							return xerrors.Errorf("remove: %w", err)
-						}
-					}
-				}
-
-				return nil
-			})
+	profiles := a.opt.Profiles
+	if len(profiles) == 0 {
+		// Using default session from environment.
+		profiles = []string{""}
+	}
+	if len(profiles) > 1 && !cmd.MultiProfile {
+		return xerrors.Errorf("command %q does not support multiple profiles", name)
+	}
+	if n := a.opt.Network; n != "" && n != "ipv4" && n != "ipv6" {
+		return xerrors.Errorf("unknown network %q", n)
+	}
+	release, err := a.lockRun(profiles)
+	if err != nil {
+		return xerrors.Errorf("lock: %w", err)
+	}
+	defer release()
+	if a.opt.GCAge > 0 && !a.opt.ReadOnly && !isTempDir(a.opt.Out) {
+		// Output directory is locked, so no other run writes to it. System
+		// temporary directory is shared with other programs, so it is only
+		// swept by explicit gc command.
+		n, reclaimed, err := a.collectGarbage(a.opt.GCAge, false)
+		if err != nil {
+			return xerrors.Errorf("gc: %w", err)
+		}
+		if n > 0 {
+			a.log.Info("Removed stale temporary files", zap.Int("files", n), zap.Int64("reclaimed", reclaimed))
 		}
+	}
+	if _, ok := previousRunActions[a.opt.PreviousRun]; !ok {
+		return xerrors.Errorf("unknown previous run action %q", a.opt.PreviousRun)
+	}
+	if !a.opt.ReadOnly {
+		// Read-only runs write nothing to output, checkpoint there can
+		// belong to concurrent run.
+		if run, err := a.openCheckpoint(name); err != nil {
+			return xerrors.Errorf("checkpoint: %w", err)
+		} else if !run {
+			return nil
+		}
+		defer func() { _ = a.checkpoint.Close() }()
+		handler = a.finishing(handler)
+	}
+	if a.opt.Replay != "" {
+		if a.opt.Takeout || a.opt.Record != "" {
+			return xerrors.New("replay supports neither takeout, nor recording")
+		}
+		return a.replay(ctx, profiles, handler)
+	}
+	if a.opt.Record != "" {
+		r, err := newRecorder(a.store, a.opt.Record)
+		if err != nil {
+			return xerrors.Errorf("record: %w", err)
+		}
+		defer func() { _ = r.Close() }()
+		a.recorder = r
+	}
+	if a.invoker != nil {
+		return a.withInvokers(ctx, profiles, a.invoker, handler)
+	}
 
-		if err := g.Wait(); err != nil {
-			return err
+	// Connecting, performing authentication and running command.
+	return a.connect(ctx, profiles, func(ctx context.Context, clients []*telegram.Client) error {
+		a.api = a.accounts[0].API
+		if a.opt.Takeout {
+			return withTakeout(ctx, a.log, clients[0], func(ctx context.Context, invoker tg.Invoker) error {
+				a.api = tg.NewClient(invoker)
+				a.accounts[0].API = a.api
+				a.accounts[0].Invoker = invoker
+				return handler(ctx, a)
+			})
 		}
-		log.Info("Finished OK",
-			zap.Int32("downloaded", downloaded.Load()),
-			zap.Int32("total", total.Load()),
-		)
 
-		return nil
+		return handler(ctx, a)
 	})
 }
 
 func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
-	if err := run(ctx); err != nil {
-		panic(err)
+	err := run(ctx)
+	if err == nil {
+		return
+	}
+	if ctx.Err() != nil {
+		// Interrupted by user, progress of completed work is kept.
+		msg := tr("run interrupted")
+		var interrupted *interruptedError
+		if xerrors.As(err, &interrupted) {
+			msg = interrupted.Error()
+		}
+		fmt.Fprint(os.Stderr, trf("%s, run same command again to resume\n", msg))
+		cancel()
+		os.Exit(exitInterrupted)
 	}
+	fmt.Fprint(os.Stderr, trf("Error: %v\n", err))
+	os.Exit(1)
 }
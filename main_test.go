@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	for _, tt := range []struct {
+		Command string
+		Args    []string
+		// Allowed reports whether command runs in read-only mode.
+		Allowed bool
+	}{
+		{Command: "list", Allowed: true},
+		{Command: "list", Args: []string{"--csv"}, Allowed: true},
+		{Command: "list", Args: []string{"-o", "list.txt"}},
+		{Command: "stats", Allowed: true},
+		{Command: "download"},
+		{Command: "stickers"},
+		{Command: "mirror"},
+	} {
+		t.Run(tt.Command, func(t *testing.T) {
+			m := newMockInvoker()
+			mockSavedGifs(m, testGif(1, 320, 240))
+			a := newTestApp(t, m)
+			a.opt.ReadOnly = true
+
+			err := runCommand(context.Background(), a, tt.Command, tt.Args...)
+			if tt.Allowed && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.Allowed && err == nil {
+				t.Fatal("Expected error")
+			}
+			if _, err := os.Stat(a.opt.Out); !os.IsNotExist(err) {
+				t.Errorf("Output directory is created: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/telegram/message/peer"
+	"github.com/gotd/td/tg"
+)
+
+// Media kinds, also used as subdirectory names.
+const (
+	kindPhoto    = "photo"
+	kindVideo    = "video"
+	kindGIF      = "gif"
+	kindRound    = "round"
+	kindVoice    = "voice"
+	kindAudio    = "audio"
+	kindSticker  = "sticker"
+	kindDocument = "document"
+)
+
+// documentKind returns media kind of document.
+func documentKind(doc *tg.Document) string {
+	kind := kindDocument
+	for _, attr := range doc.Attributes {
+		switch attr := attr.(type) {
+		case *tg.DocumentAttributeSticker:
+			// Sticker attribute takes precedence over video one for video
+			// stickers.
+			return kindSticker
+		case *tg.DocumentAttributeAnimated:
+			return kindGIF
+		case *tg.DocumentAttributeAudio:
+			if attr.Voice {
+				kind = kindVoice
+			} else {
+				kind = kindAudio
+			}
+		case *tg.DocumentAttributeVideo:
+			if attr.RoundMessage {
+				kind = kindRound
+			} else if kind == kindDocument {
+				kind = kindVideo
+			}
+		}
+	}
+	return kind
+}
+
+// messageFile returns file for media of msg, stored in "<dir>/<kind>".
+func messageFile(dir, source string, msg *tg.Message) (file, bool) {
+	var (
+		f  file
+		ok bool
+	)
+	switch media := msg.Media.(type) {
+	case *tg.MessageMediaPhoto:
+		photo, isPhoto := media.Photo.AsNotEmpty()
+		if !isPhoto {
+			return file{}, false
+		}
+		f, ok = photoFile(filepath.Join(dir, kindPhoto), source, photo)
+		f.Meta.Kind = kindPhoto
+	case *tg.MessageMediaDocument:
+		doc, isDoc := media.Document.AsNotEmpty()
+		if !isDoc {
+			return file{}, false
+		}
+		f, ok = documentFile(filepath.Join(dir, documentKind(doc)), source, doc), true
+	}
+	if !ok {
+		return file{}, false
+	}
+
+	f.Meta.MessageID = msg.ID
+	f.Meta.Caption = msg.Message
+	return f, true
+}
+
+// setSender sets sender of msg to metadata of f, resolving its name from
+// entities. Channel posts without author are attributed to channel.
+func setSender(f *file, msg *tg.Message, ent peer.Entities) {
+	from, ok := msg.GetFromID()
+	if !ok {
+		from = msg.PeerID
+	}
+	switch from := from.(type) {
+	case *tg.PeerUser:
+		f.Meta.SenderID = from.UserID
+		if u, ok := ent.User(from.UserID); ok {
+			f.Meta.Sender = userName(u)
+		}
+	case *tg.PeerChannel:
+		f.Meta.SenderID = from.ChannelID
+		if c, ok := ent.Channel(from.ChannelID); ok {
+			f.Meta.Sender = c.Title
+		}
+	case *tg.PeerChat:
+		f.Meta.SenderID = from.ChatID
+		if c, ok := ent.Chat(from.ChatID); ok {
+			f.Meta.Sender = c.Title
+		}
+	}
+}
+
+// userName returns "@username" of user or full name if user has no
+// username.
+func userName(u *tg.User) string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
+
+// nameTemplate renders file name template with "{id}", "{msg}", "{date}",
+// "{sender}" and "{caption}" placeholders for f, keeping extension and
+// directory of f.
+func nameTemplate(tmpl string, f file) string {
+	caption := strings.SplitN(f.Meta.Caption, "\n", 2)[0]
+	if r := []rune(caption); len(r) > 64 {
+		caption = string(r[:64])
+	}
+	name := strings.NewReplacer(
+		"{id}", strconv.FormatInt(f.Meta.ID, 10),
+		"{msg}", strconv.Itoa(f.Meta.MessageID),
+		"{date}", f.Meta.Date.Format("2006-01-02"),
+		"{sender}", strings.TrimPrefix(f.Meta.Sender, "@"),
+		"{caption}", caption,
+	).Replace(tmpl)
+	return filepath.Join(filepath.Dir(f.Name), safeName(name)+filepath.Ext(f.Name))
+}
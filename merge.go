@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// contentHash returns SHA-256 of file contents.
+func contentHash(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// merge is union of saved gifs of all accounts, de-duplicated by document
+// ID before download and by content hash after.
+type merge struct {
+	app *app
+
+	mux    sync.Mutex
+	hashes map[string]string // hash -> name
+}
+
+// newMerge creates merge, hashing gifs already present in output directory.
+func (a *app) newMerge(ctx context.Context) (*merge, error) {
+	m := &merge{app: a, hashes: map[string]string{}}
+
+	entries, err := os.ReadDir(a.opt.Out)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, xerrors.Errorf("dir: %w", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".mp4" {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		hash, err := contentHash(filepath.Join(a.opt.Out, e.Name()))
+		if err != nil {
+			return nil, xerrors.Errorf("hash: %w", err)
+		}
+		m.hashes[hash] = e.Name()
+	}
+
+	return m, nil
+}
+
+// Source sends saved gifs of all accounts, skipping documents with same ID.
+func (m *merge) Source(ctx context.Context, files chan<- file) error {
+	seen := map[int64]struct{}{}
+	for _, acc := range m.app.accounts {
+		docs, err := listSavedGifs(ctx, acc.API)
+		if err != nil {
+			return xerrors.Errorf("profile %q: %w", acc.Profile, err)
+		}
+		m.app.log.Info("Got gifs",
+			zap.String("profile", acc.Profile),
+			zap.Int("count", len(docs)),
+		)
+
+		for _, doc := range docs {
+			if _, ok := seen[doc.ID]; ok {
+				continue
+			}
+			seen[doc.ID] = struct{}{}
+
+			f := documentFile("", "gifs", doc)
+			f.Name = fmt.Sprintf("%d.mp4", doc.ID)
+			f.API = acc.API
+			f.Refresh = savedGifRefresher(acc.API)
+			if err := send(ctx, files, f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Done removes downloaded file if same content was already downloaded
+// under other document ID.
+func (m *merge) Done(_ context.Context, f file) error {
+	name := filepath.Join(m.app.opt.Out, f.Name)
+	hash, err := contentHash(name)
+	if err != nil {
+		return xerrors.Errorf("hash: %w", err)
+	}
+
+	m.mux.Lock()
+	existing, ok := m.hashes[hash]
+	if !ok {
+		m.hashes[hash] = f.Name
+	}
+	m.mux.Unlock()
+
+	if ok {
+		m.app.log.Info("Removing duplicate",
+			zap.String("name", f.Name),
+			zap.String("same_as", existing),
+		)
+		return os.Remove(name)
+	}
+	return nil
+}
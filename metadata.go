@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"golang.org/x/xerrors"
+)
+
+// metadata describes downloaded file and is stored as JSON sidecar.
+type metadata struct {
+	ID       int64     `json:"id"`
+	Date     time.Time `json:"date"`
+	Source   string    `json:"source,omitempty"`
+	MIME     string    `json:"mime,omitempty"`
+	Size     int       `json:"size,omitempty"`
+	Width    int       `json:"width,omitempty"`
+	Height   int       `json:"height,omitempty"`
+	Duration float64   `json:"duration,omitempty"`
+	Emoji    string    `json:"emoji,omitempty"`
+	SetID    int64     `json:"set_id,omitempty"`
+	Kind     string    `json:"kind,omitempty"`
+	FileName string    `json:"file_name,omitempty"`
+	// Color is average color of thumbnail or first frame, "#rrggbb".
+	Color string `json:"color,omitempty"`
+
+	// Title and Performer are set for audio.
+	Title     string `json:"title,omitempty"`
+	Performer string `json:"performer,omitempty"`
+
+	// MessageID, Caption and sender are set for files from messages.
+	MessageID int    `json:"message_id,omitempty"`
+	Caption   string `json:"caption,omitempty"`
+	SenderID  int    `json:"sender_id,omitempty"`
+	Sender    string `json:"sender,omitempty"`
+}
+
+// documentMetadata extracts metadata from document attributes.
+func documentMetadata(source string, doc *tg.Document) metadata {
+	m := metadata{
+		ID:     doc.ID,
+		Date:   time.Unix(int64(doc.Date), 0),
+		Source: source,
+		MIME:   doc.MimeType,
+		Size:   doc.Size,
+		Kind:   documentKind(doc),
+		Color:  thumbColor(doc),
+	}
+	for _, attr := range doc.Attributes {
+		switch attr := attr.(type) {
+		case *tg.DocumentAttributeVideo:
+			m.Width, m.Height = attr.W, attr.H
+			m.Duration = float64(attr.Duration)
+		case *tg.DocumentAttributeAudio:
+			m.Duration = float64(attr.Duration)
+			m.Title, m.Performer = attr.Title, attr.Performer
+		case *tg.DocumentAttributeFilename:
+			m.FileName = attr.FileName
+		case *tg.DocumentAttributeImageSize:
+			m.Width, m.Height = attr.W, attr.H
+		case *tg.DocumentAttributeSticker:
+			m.Emoji = attr.Alt
+			if set, ok := attr.Stickerset.(*tg.InputStickerSetID); ok {
+				m.SetID = set.ID
+			}
+		}
+	}
+	return m
+}
+
+// documentExt returns file extension for document, including leading dot.
+func documentExt(doc *tg.Document) string {
+	switch doc.MimeType {
+	case "video/mp4":
+		return ".mp4"
+	case "video/webm":
+		return ".webm"
+	case "image/webp":
+		return ".webp"
+	case "application/x-tgsticker":
+		return ".tgs"
+	case "image/gif":
+		return ".gif"
+	case "image/jpeg":
+		return ".jpg"
+	case "audio/ogg":
+		// Voice notes are conventionally ".ogg", while other Ogg audio is
+		// ".oga".
+		if documentKind(doc) == kindVoice {
+			return ".ogg"
+		}
+		return ".oga"
+	case "audio/mpeg":
+		return ".mp3"
+	}
+	for _, attr := range doc.Attributes {
+		if name, ok := attr.(*tg.DocumentAttributeFilename); ok && filepath.Ext(name.FileName) != "" {
+			return strings.ToLower(filepath.Ext(name.FileName))
+		}
+	}
+	if exts, err := mime.ExtensionsByType(doc.MimeType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// writeSidecar writes m as JSON to "<name>.json".
+func writeSidecar(store storage, name string, m metadata) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return xerrors.Errorf("encode: %w", err)
+	}
+	if err := store.WriteFile(name+".json", append(data, '\n'), 0o640); err != nil {
+		return xerrors.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+// readSidecar reads metadata from "<name>.json".
+func readSidecar(name string) (metadata, error) {
+	var m metadata
+	data, err := os.ReadFile(name + ".json")
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return m, xerrors.Errorf("decode: %w", err)
+	}
+	return m, nil
+}
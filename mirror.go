@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/xerrors"
+)
+
+// mirrorKey identifies same gif in saved gifs of different accounts, where
+// document IDs differ.
+func mirrorKey(m metadata) string {
+	return fmt.Sprintf("%d:%dx%d:%.0f:%s", m.Size, m.Width, m.Height, m.Duration, m.MIME)
+}
+
+// mirrorLooseKey identifies gifs which can be same gif re-encoded, e.g. by
+// client on upload, so differ in size only.
+func mirrorLooseKey(m metadata) string {
+	return fmt.Sprintf("%dx%d:%.0f", m.Width, m.Height, m.Duration)
+}
+
+// mirrorPlan is list of changes made by mirror.
+type mirrorPlan struct {
+	// Upload are paths of gifs downloaded by previous run, which are only
+	// uploaded.
+	Upload []string
+	// Download are gifs of source account, which are downloaded and
+	// uploaded.
+	Download []file
+	// Unsave are gifs of destination account missing in source one.
+	Unsave []*tg.Document
+}
+
+// Empty reports whether plan changes nothing.
+func (p mirrorPlan) Empty() bool {
+	return len(p.Upload) == 0 && len(p.Download) == 0 && len(p.Unsave) == 0
+}
+
+// write writes plan in diff style, line per change.
+func (p mirrorPlan) write(w io.Writer, out string) {
+	for _, name := range p.Upload {
+		_, _ = fmt.Fprintf(w, "+ upload %s\n", name)
+	}
+	for _, f := range p.Download {
+		_, _ = fmt.Fprintf(w, "↓ download %d\n", f.Meta.ID)
+		_, _ = fmt.Fprintf(w, "+ upload %s\n", filepath.Join(out, f.Name))
+	}
+	for _, doc := range p.Unsave {
+		_, _ = fmt.Fprintf(w, "- unsave %d\n", doc.ID)
+	}
+}
+
+// mirrorCmd copies saved gifs of first profile to saved gifs of second one.
+//
+// Download of next gif is overlapped with upload of previous ones: downloaded
+// files are queued to uploader via bounded channel, so at most -j files wait
+// for upload at once.
+func mirrorCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		apply  = fs.Bool("apply", false, "apply plan without confirmation")
+		unsave = fs.Bool("delete", false, "unsave gifs of second profile missing in first one")
+	)
+	return func(ctx context.Context, a *app) error {
+		if len(a.accounts) != 2 {
+			return xerrors.New(tr("usage: mirror --profile <from> --profile <to>"))
+		}
+		from, to := a.accounts[0], a.accounts[1]
+
+		j, err := a.openJournal(ctx)
+		if err != nil {
+			return xerrors.Errorf("journal: %w", err)
+		}
+		a.journal = j
+
+		existing, err := listSavedGifs(ctx, to.API)
+		if err != nil {
+			return xerrors.Errorf("profile %q: %w", to.Profile, err)
+		}
+		mirrored := map[string]struct{}{}
+		for _, doc := range existing {
+			mirrored[mirrorKey(documentMetadata("gifs", doc))] = struct{}{}
+		}
+		docs, err := listSavedGifs(ctx, from.API)
+		if err != nil {
+			return xerrors.Errorf("profile %q: %w", from.Profile, err)
+		}
+		a.log.Info("Got gifs",
+			zap.String("from", from.Profile),
+			zap.Int("count", len(docs)),
+			zap.String("to", to.Profile),
+			zap.Int("existing", len(existing)),
+		)
+
+		var plan mirrorPlan
+		source := map[string]struct{}{}
+		similar := map[string]struct{}{}
+		dir := filepath.Join("mirror", from.Profile)
+		for _, doc := range docs {
+			f := documentFile(dir, "gifs", doc)
+			key := mirrorKey(f.Meta)
+			source[key] = struct{}{}
+			similar[mirrorLooseKey(f.Meta)] = struct{}{}
+			if _, ok := mirrored[key]; ok {
+				continue
+			}
+			if !a.filter.Empty() && !a.filter.Match(f.Meta) {
+				continue
+			}
+			// Downloaded on previous run, but not uploaded.
+			if name := filepath.Join(a.opt.Out, f.Name); fileExists(name) {
+				plan.Upload = append(plan.Upload, name)
+				continue
+			}
+			// Downloaded elsewhere, e.g. by download with other output,
+			// which download skips or relinks without calling Done.
+			if e, ok, err := a.indexed(from.Profile, doc.ID); err != nil {
+				return err
+			} else if ok {
+				plan.Upload = append(plan.Upload, e.Path)
+				continue
+			}
+			f.API = from.API
+			f.Refresh = savedGifRefresher(from.API)
+			plan.Download = append(plan.Download, f)
+		}
+		if *unsave {
+			for _, doc := range existing {
+				m := documentMetadata("gifs", doc)
+				if _, ok := source[mirrorKey(m)]; ok {
+					continue
+				}
+				if _, ok := similar[mirrorLooseKey(m)]; ok {
+					// Can be re-encoded copy of source gif, so not risking
+					// to unsave it.
+					a.log.Warn("Not unsaving gif similar to source one", zap.Int64("id", doc.ID))
+					continue
+				}
+				plan.Unsave = append(plan.Unsave, doc)
+			}
+		}
+
+		if plan.Empty() {
+			a.log.Info("Nothing to mirror")
+			return nil
+		}
+		plan.write(os.Stdout, a.opt.Out)
+		if !*apply {
+			answer, err := a.prompt.Prompt(tr("Apply plan? [y/N] "))
+			if err != nil && err != io.EOF {
+				return err
+			}
+			if answer = strings.ToLower(answer); answer != "y" && answer != "yes" {
+				fmt.Print(tr("Plan is not applied, confirm it or use --apply\n"))
+				return nil
+			}
+		}
+
+		u := newGifUploader(a.log, to.Invoker, uploadOptions{
+			Store:    a.store,
+			Validate: a.opt.Validate,
+			Journal:  j,
+			Profile:  to.Profile,
+			Wait: func(ctx context.Context) error {
+				return a.waitTransfer(ctx, to.Profile)
+			},
+			Transferred: func(n int64) {
+				a.addTransfer(to.Profile, n)
+			},
+		})
+		uploads := make(chan string, a.opt.Jobs)
+		queue := func(ctx context.Context, name string) error {
+			select {
+			case uploads <- name:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		g, gctx := errgroup.WithContext(ctx)
+		g.Go(func() error {
+			var corrupt []string
+			for name := range uploads {
+				ok, err := u.Upload(gctx, name)
+				if err != nil {
+					return xerrors.Errorf("upload %s: %w", name, err)
+				}
+				if !ok {
+					corrupt = append(corrupt, name)
+				}
+			}
+			if len(corrupt) > 0 {
+				a.log.Warn("Corrupt files were not uploaded", zap.Strings("names", corrupt))
+			}
+			return nil
+		})
+		g.Go(func() error {
+			defer close(uploads)
+			return a.download(gctx, pipeline{
+				Source: func(ctx context.Context, files chan<- file) error {
+					for _, name := range plan.Upload {
+						if err := queue(ctx, name); err != nil {
+							return err
+						}
+					}
+					for _, f := range plan.Download {
+						if err := send(ctx, files, f); err != nil {
+							return err
+						}
+					}
+					return nil
+				},
+				Done: func(ctx context.Context, f file) error {
+					return queue(ctx, filepath.Join(a.opt.Out, f.Name))
+				},
+			})
+		})
+		if err := g.Wait(); err != nil {
+			return err
+		}
+
+		for _, doc := range plan.Unsave {
+			if err := a.retryFlood(ctx, func(ctx context.Context) error {
+				return saveGif(ctx, to.API, doc, true)
+			}); err != nil {
+				return xerrors.Errorf("unsave %d: %w", doc.ID, err)
+			}
+			a.log.Info("Unsaved", zap.Int64("id", doc.ID))
+		}
+		return nil
+	}
+}
+
+// fileExists reports whether name exists.
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
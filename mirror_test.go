@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+func TestMirrorUnsave(t *testing.T) {
+	from := newMockInvoker()
+	mockSavedGifs(from, testGif(1, 320, 240))
+	to := newMockInvoker()
+	reencoded := testGif(3, 320, 240)
+	reencoded.Size++
+	// Gif 3 is re-encoded copy of gif 1, gif 4 is missing in source.
+	mockSavedGifs(to, reencoded, testGif(4, 100, 100))
+	mockUploads(to, 100)
+	var unsaved []int64
+	to.On(tg.MessagesSaveGifRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+		if r := req.(*tg.MessagesSaveGifRequest); r.Unsave {
+			unsaved = append(unsaved, r.ID.(*tg.InputDocument).ID)
+		}
+		return &tg.BoolTrue{}, nil
+	})
+
+	a := newTestApp(t, nil)
+	a.invoker = func(profile string) tg.Invoker {
+		if profile == "from" {
+			return from
+		}
+		return to
+	}
+	if err := runCommand(context.Background(), a, "mirror",
+		"--profile", "from", "--profile", "to", "--apply", "--delete",
+	); err != nil {
+		t.Fatal(err)
+	}
+	if len(unsaved) != 1 || unsaved[0] != 4 {
+		t.Errorf("Unsaved %v, expected [4]", unsaved)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/clock"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap/zaptest"
+	"golang.org/x/xerrors"
+)
+
+// testSelf is user of mocked account.
+var testSelf = &tg.User{Self: true, ID: 1, AccessHash: 1, FirstName: "Test"}
+
+// mockHandler returns result of request.
+type mockHandler func(req bin.Encoder) (bin.Encoder, error)
+
+// mockInvoker implements tg.Invoker answering requests by handlers of their
+// types, failing unexpected ones.
+type mockInvoker struct {
+	mux      sync.Mutex
+	handlers map[uint32]mockHandler
+	calls    map[uint32]int
+}
+
+// newMockInvoker creates mockInvoker of testSelf account.
+func newMockInvoker() *mockInvoker {
+	m := &mockInvoker{
+		handlers: map[uint32]mockHandler{},
+		calls:    map[uint32]int{},
+	}
+	m.On(tg.UsersGetUsersRequestTypeID, func(bin.Encoder) (bin.Encoder, error) {
+		return &tg.UserClassVector{Elems: []tg.UserClass{testSelf}}, nil
+	})
+	return m
+}
+
+// On sets handler of requests with type ID.
+func (m *mockInvoker) On(id uint32, h mockHandler) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.handlers[id] = h
+}
+
+// Calls returns count of requests with type ID.
+func (m *mockInvoker) Calls(id uint32) int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.calls[id]
+}
+
+// Invoke implements tg.Invoker.
+func (m *mockInvoker) Invoke(_ context.Context, input bin.Encoder, output bin.Decoder) error {
+	var b bin.Buffer
+	if err := input.Encode(&b); err != nil {
+		return err
+	}
+	id, err := b.PeekID()
+	if err != nil {
+		return err
+	}
+	m.mux.Lock()
+	h, ok := m.handlers[id]
+	m.calls[id]++
+	m.mux.Unlock()
+	if !ok {
+		return xerrors.Errorf("unexpected request %T", input)
+	}
+
+	result, err := h(input)
+	if err != nil {
+		return err
+	}
+	b.Reset()
+	if err := result.Encode(&b); err != nil {
+		return err
+	}
+	return output.Decode(&b)
+}
+
+// failingPrompter fails test on any prompt.
+type failingPrompter struct {
+	t *testing.T
+}
+
+func (p failingPrompter) Prompt(text string) (string, error) {
+	p.t.Errorf("Unexpected prompt %q", text)
+	return "", xerrors.New("unexpected prompt")
+}
+
+// setenv sets environment variable for duration of test, as t.Setenv is
+// not available in go 1.16.
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+	prev, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, prev)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+// newTestApp creates app answering RPC calls by invoker, if not nil, with
+// output and session directories in temporary directory of test.
+func newTestApp(t *testing.T, invoker tg.Invoker) *app {
+	t.Helper()
+	dir := t.TempDir()
+	setenv(t, "SESSION_DIR", filepath.Join(dir, "session"))
+	setenv(t, "SESSION_FILE", filepath.Join(dir, "session", "session.json"))
+
+	opt := defaultOptions()
+	opt.Out = filepath.Join(dir, "out")
+	opt.Validate = false
+	opt.GCAge = 0
+	a := &app{
+		opt:    opt,
+		log:    zaptest.NewLogger(t),
+		clock:  clock.System,
+		prompt: failingPrompter{t: t},
+		store:  newDiskStorage(),
+	}
+	if invoker != nil {
+		a.invoker = func(string) tg.Invoker { return invoker }
+	}
+	return a
+}
+
+// runCommand runs command with args as run does.
+func runCommand(ctx context.Context, a *app, name string, args ...string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return xerrors.Errorf("unknown command %q", name)
+	}
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	a.opt.register(fs)
+	handler := cmd.Setup(fs)
+	if err := parseInterspersed(fs, args); err != nil {
+		return err
+	}
+	if cmd.Online != nil && cmd.Online(fs.Args()) {
+		cmd.Offline = false
+	}
+	return a.exec(ctx, name, cmd, handler)
+}
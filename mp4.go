@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// mp4Info is video attributes parsed from mp4 container.
+type mp4Info struct {
+	// Duration in seconds.
+	Duration float64
+	Width    int
+	Height   int
+	// FPS is average frame rate of video track, zero if unknown.
+	FPS float64
+}
+
+// mp4Box is header of ISO BMFF box.
+type mp4Box struct {
+	Type string
+	// Offset and Size of box payload, excluding header.
+	Offset int64
+	Size   int64
+}
+
+// mp4Boxes returns boxes in [offset, end) of r.
+func mp4Boxes(r io.ReaderAt, offset, end int64) ([]mp4Box, error) {
+	var boxes []mp4Box
+	for offset+8 <= end {
+		var hdr [16]byte
+		if _, err := r.ReadAt(hdr[:8], offset); err != nil {
+			return nil, err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[:4]))
+		headerSize := int64(8)
+		switch size {
+		case 0:
+			// Box extends to end of file.
+			size = end - offset
+		case 1:
+			if _, err := r.ReadAt(hdr[8:16], offset+8); err != nil {
+				return nil, err
+			}
+			size = int64(binary.BigEndian.Uint64(hdr[8:16]))
+			headerSize = 16
+		}
+		if size < headerSize || offset+size > end {
+			return nil, xerrors.Errorf("invalid %q box size %d", hdr[4:8], size)
+		}
+		boxes = append(boxes, mp4Box{
+			Type:   string(hdr[4:8]),
+			Offset: offset + headerSize,
+			Size:   size - headerSize,
+		})
+		offset += size
+	}
+	return boxes, nil
+}
+
+// mp4Child returns first child box of parent with type t.
+func mp4Child(r io.ReaderAt, parent mp4Box, t string) (mp4Box, bool, error) {
+	boxes, err := mp4Boxes(r, parent.Offset, parent.Offset+parent.Size)
+	if err != nil {
+		return mp4Box{}, false, err
+	}
+	for _, b := range boxes {
+		if b.Type == t {
+			return b, true, nil
+		}
+	}
+	return mp4Box{}, false, nil
+}
+
+// readBox reads payload of box.
+func readBox(r io.ReaderAt, b mp4Box) ([]byte, error) {
+	if b.Size > 1<<20 {
+		return nil, xerrors.Errorf("%q box is too big", b.Type)
+	}
+	buf := make([]byte, b.Size)
+	if _, err := r.ReadAt(buf, b.Offset); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// parseMVHD returns duration in seconds from movie header box payload.
+func parseMVHD(p []byte) (float64, error) {
+	var timescale, duration uint64
+	switch {
+	case len(p) >= 20 && p[0] == 0:
+		timescale = uint64(binary.BigEndian.Uint32(p[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(p[16:20]))
+	case len(p) >= 32 && p[0] == 1:
+		timescale = uint64(binary.BigEndian.Uint32(p[20:24]))
+		duration = binary.BigEndian.Uint64(p[24:32])
+	default:
+		return 0, xerrors.New("invalid mvhd")
+	}
+	if timescale == 0 {
+		return 0, xerrors.New("zero timescale")
+	}
+	return float64(duration) / float64(timescale), nil
+}
+
+// parseTKHD returns dimensions from track header box payload.
+func parseTKHD(p []byte) (w, h int, err error) {
+	// Version and flags, times, track ID and duration are followed by
+	// 52 bytes of reserved fields, layer, group, volume and matrix.
+	offset := 4 + 20 + 52
+	if len(p) > 0 && p[0] == 1 {
+		offset = 4 + 32 + 52
+	}
+	if len(p) < offset+8 {
+		return 0, 0, xerrors.New("invalid tkhd")
+	}
+	// Dimensions are 16.16 fixed-point.
+	w = int(binary.BigEndian.Uint32(p[offset:offset+4]) >> 16)
+	h = int(binary.BigEndian.Uint32(p[offset+4:offset+8]) >> 16)
+	return w, h, nil
+}
+
+// trackFPS returns average frame rate of track: count of samples in its
+// time-to-sample box per second of media duration.
+func trackFPS(r io.ReaderAt, trak mp4Box) (float64, error) {
+	box := trak
+	for _, t := range []string{"mdia", "mdhd"} {
+		b, ok, err := mp4Child(r, box, t)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, xerrors.Errorf("no %s box", t)
+		}
+		box = b
+	}
+	p, err := readBox(r, box)
+	if err != nil {
+		return 0, err
+	}
+	// Media header has same layout of timescale and duration as movie one.
+	duration, err := parseMVHD(p)
+	if err != nil {
+		return 0, xerrors.Errorf("mdhd: %w", err)
+	}
+	if duration <= 0 {
+		return 0, xerrors.New("zero duration")
+	}
+
+	box = trak
+	for _, t := range []string{"mdia", "minf", "stbl", "stts"} {
+		b, ok, err := mp4Child(r, box, t)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return 0, xerrors.Errorf("no %s box", t)
+		}
+		box = b
+	}
+	if p, err = readBox(r, box); err != nil {
+		return 0, err
+	}
+	if len(p) < 8 {
+		return 0, xerrors.New("invalid stts")
+	}
+	// Entries of sample count and delta follow version, flags and count.
+	var samples uint64
+	for p = p[8:]; len(p) >= 8; p = p[8:] {
+		samples += uint64(binary.BigEndian.Uint32(p[:4]))
+	}
+	return float64(samples) / duration, nil
+}
+
+// probeMP4 parses duration, dimensions and frame rate of first video track
+// of mp4 file without ffmpeg.
+func probeMP4(name string) (mp4Info, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return mp4Info{}, err
+	}
+	defer func() { _ = f.Close() }()
+	stat, err := f.Stat()
+	if err != nil {
+		return mp4Info{}, err
+	}
+
+	root, err := mp4Boxes(f, 0, stat.Size())
+	if err != nil {
+		return mp4Info{}, err
+	}
+	var info mp4Info
+	for _, moov := range root {
+		if moov.Type != "moov" {
+			continue
+		}
+		boxes, err := mp4Boxes(f, moov.Offset, moov.Offset+moov.Size)
+		if err != nil {
+			return mp4Info{}, err
+		}
+		for _, b := range boxes {
+			switch b.Type {
+			case "mvhd":
+				p, err := readBox(f, b)
+				if err != nil {
+					return mp4Info{}, err
+				}
+				if info.Duration, err = parseMVHD(p); err != nil {
+					return mp4Info{}, err
+				}
+			case "trak":
+				if info.Width > 0 {
+					continue
+				}
+				tkhd, ok, err := mp4Child(f, b, "tkhd")
+				if err != nil {
+					return mp4Info{}, xerrors.Errorf("tkhd: %w", err)
+				}
+				if !ok {
+					continue
+				}
+				p, err := readBox(f, tkhd)
+				if err != nil {
+					return mp4Info{}, err
+				}
+				// Audio tracks have zero dimensions.
+				if info.Width, info.Height, err = parseTKHD(p); err != nil {
+					return mp4Info{}, err
+				}
+				if info.Width > 0 {
+					// Frame rate is optional, e.g. for fragmented files.
+					info.FPS, _ = trackFPS(f, b)
+				}
+			}
+		}
+		return info, nil
+	}
+	return mp4Info{}, xerrors.New("no moov box")
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testVideo writes mp4 file with moov of single w×h video track of frames
+// of one second long, returning its name.
+func testVideo(t *testing.T, w, h, frames int) string {
+	t.Helper()
+	// Timescale and duration of movie and media headers, version 0.
+	header := make([]byte, 24)
+	binary.BigEndian.PutUint32(header[12:], 1000)
+	binary.BigEndian.PutUint32(header[16:], 1000)
+	tkhd := make([]byte, 84)
+	binary.BigEndian.PutUint32(tkhd[76:], uint32(w)<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], uint32(h)<<16)
+	// Two entries of time-to-sample box.
+	stts := make([]byte, 24)
+	binary.BigEndian.PutUint32(stts[4:], 2)
+	binary.BigEndian.PutUint32(stts[8:], uint32(frames-1))
+	binary.BigEndian.PutUint32(stts[12:], 1000/uint32(frames))
+	binary.BigEndian.PutUint32(stts[16:], 1)
+	binary.BigEndian.PutUint32(stts[20:], 1000/uint32(frames))
+
+	moov := testBox("moov",
+		testBox("mvhd", header),
+		testBox("trak",
+			testBox("tkhd", tkhd),
+			testBox("mdia",
+				testBox("mdhd", header),
+				testBox("minf", testBox("stbl", testBox("stts", stts))),
+			),
+		),
+	)
+	data := bytes.Join([][]byte{testBox("ftyp", []byte("isom")), moov, testBox("mdat", []byte("data"))}, nil)
+	name := filepath.Join(t.TempDir(), "video.mp4")
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestProbeMP4(t *testing.T) {
+	info, err := probeMP4(testVideo(t, 320, 240, 25))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (mp4Info{Duration: 1, Width: 320, Height: 240, FPS: 25}); info != expected {
+		t.Errorf("Got %+v, expected %+v", info, expected)
+	}
+}
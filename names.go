@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/xerrors"
+)
+
+// collisionStrategies are supported ways to resolve file name collisions.
+var collisionStrategies = map[string]struct{}{
+	"suffix":    {},
+	"hash":      {},
+	"overwrite": {},
+	"error":     {},
+}
+
+// collisions resolves collisions of file names, e.g. rendered from template
+// or original file names, between files of different IDs.
+type collisions struct {
+	// Strategy is one of collisionStrategies.
+	Strategy string
+
+	mux sync.Mutex
+	// claimed maps names of files of current run to their IDs.
+	claimed map[string]int64
+}
+
+// suffixed returns name with suffix added before extension.
+func suffixed(name, suffix string) string {
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "_" + suffix + ext
+}
+
+// shortHash returns short hash of ID for name suffix.
+func shortHash(id int64) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strconv.FormatInt(id, 10)))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// taken reports whether name in out directory belongs to file of other ID,
+// either claimed in current run or downloaded before with sidecar.
+func (c *collisions) taken(out, name string, id int64) bool {
+	if owner, ok := c.claimed[name]; ok {
+		return owner != id
+	}
+	m, err := readSidecar(filepath.Join(out, name))
+	return err == nil && m.ID != id
+}
+
+// claim returns name to store f as in out directory, reporting whether
+// existing file of other ID should be overwritten.
+func (c *collisions) claim(out string, f file) (name string, overwrite bool, err error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.claimed == nil {
+		c.claimed = map[string]int64{}
+	}
+
+	id := f.Meta.ID
+	name = f.Name
+	if c.taken(out, name, id) {
+		switch c.Strategy {
+		case "overwrite":
+			overwrite = true
+		case "error":
+			return "", false, xerrors.Errorf("%s: name is taken by other file", name)
+		case "hash":
+			name = suffixed(f.Name, shortHash(id))
+			if c.taken(out, name, id) {
+				return "", false, xerrors.Errorf("%s: name is taken by other file", name)
+			}
+		default:
+			for i := 2; c.taken(out, name, id); i++ {
+				name = suffixed(f.Name, strconv.Itoa(i))
+			}
+		}
+	}
+	c.claimed[name] = id
+	return name, overwrite, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// networkState is connection state learned by client, stored per profile
+// so next run connects to right DC without migration.
+type networkState struct {
+	// DC is ID of home DC of account.
+	DC int `json:"dc"`
+	// Options are addresses of all DCs from last config.
+	Options []tg.DCOption `json:"options,omitempty"`
+	// Network is preferred IP version, "ipv4" or "ipv6".
+	Network string `json:"network,omitempty"`
+}
+
+// networkStatePath returns path of network state of profile.
+func networkStatePath(profile string) (string, error) {
+	lock, err := sessionLockPath(profile)
+	if err != nil {
+		return "", err
+	}
+	// Stored next to session, same as lock.
+	return filepath.Join(filepath.Dir(lock), "network.json"), nil
+}
+
+// loadNetworkState loads network state of profile, returning zero state if
+// there is none.
+func loadNetworkState(profile string) (networkState, error) {
+	path, err := networkStatePath(profile)
+	if err != nil {
+		return networkState{}, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return networkState{}, nil
+	}
+	if err != nil {
+		return networkState{}, err
+	}
+	var s networkState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return networkState{}, xerrors.Errorf("decode: %w", err)
+	}
+	return s, nil
+}
+
+// saveNetworkState stores network state of profile.
+func saveNetworkState(store storage, profile string, s networkState) error {
+	path, err := networkStatePath(profile)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := store.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return store.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// networkState returns stored network state of profile with preferences
+// from options applied.
+func (a *app) networkState(profile string) networkState {
+	s, err := loadNetworkState(profile)
+	if err != nil {
+		a.log.Warn("Failed to load network state", zap.String("profile", profile), zap.Error(err))
+	}
+	if a.opt.Network != "" {
+		s.Network = a.opt.Network
+	}
+	return s
+}
+
+// saveNetworkState stores network state learned by connected client of
+// profile.
+func (a *app) saveNetworkState(profile string, client *telegram.Client) {
+	if a.opt.ReadOnly {
+		return
+	}
+	cfg := client.Config()
+	if cfg.ThisDC == 0 {
+		// Config is not received yet.
+		return
+	}
+	s := a.networkState(profile)
+	s.DC = cfg.ThisDC
+	if len(cfg.DCOptions) > 0 {
+		s.Options = cfg.DCOptions
+	}
+	if err := saveNetworkState(a.store, profile, s); err != nil {
+		a.log.Warn("Failed to save network state", zap.String("profile", profile), zap.Error(err))
+	}
+}
+
+// apply configures client options by state.
+//
+// NB: Resolver with preferred network dials directly, ignoring proxy.
+func (s networkState) apply(opts *telegram.Options) {
+	if s.DC != 0 {
+		opts.DC = s.DC
+	}
+	if len(s.Options) > 0 {
+		opts.DCList = dcs.List{Options: s.Options}
+	}
+	if s.Network != "" {
+		opts.Resolver = dcs.Plain(dcs.PlainOptions{PreferIPv6: s.Network == "ipv6"})
+	}
+}
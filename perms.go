@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// permissions are mode and ownership of written files and directories, e.g.
+// to match policies of shared storage. Zero modes and negative IDs keep
+// defaults.
+type permissions struct {
+	File os.FileMode
+	Dir  os.FileMode
+	UID  int
+	GID  int
+}
+
+// parseMode parses octal mode like "0644", empty string is zero mode.
+func parseMode(s string) (os.FileMode, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || m > 0o777 {
+		return 0, xerrors.Errorf("invalid mode %q", s)
+	}
+	return os.FileMode(m), nil
+}
+
+// lookupID resolves user or group name or numeric ID, empty string is -1.
+func lookupID(s string, lookup func(string) (string, error)) (int, error) {
+	if s == "" {
+		return -1, nil
+	}
+	if id, err := strconv.Atoi(s); err == nil {
+		return id, nil
+	}
+	id, err := lookup(s)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(id)
+}
+
+// parsePermissions parses modes and owner in "user[:group]" format.
+func parsePermissions(file, dir, owner string) (permissions, error) {
+	p := permissions{UID: -1, GID: -1}
+	var err error
+	if p.File, err = parseMode(file); err != nil {
+		return p, err
+	}
+	if p.Dir, err = parseMode(dir); err != nil {
+		return p, err
+	}
+	parts := strings.SplitN(owner, ":", 2)
+	if p.UID, err = lookupID(parts[0], func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	}); err != nil {
+		return p, xerrors.Errorf("owner: %w", err)
+	}
+	if len(parts) == 2 {
+		if p.GID, err = lookupID(parts[1], func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		}); err != nil {
+			return p, xerrors.Errorf("group: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// apply sets mode and ownership of file or directory name.
+func (p permissions) apply(name string, dir bool) error {
+	mode := p.File
+	if dir {
+		mode = p.Dir
+	}
+	if mode != 0 {
+		if err := os.Chmod(name, mode); err != nil {
+			return err
+		}
+	}
+	if p.UID >= 0 || p.GID >= 0 {
+		if err := os.Chown(name, p.UID, p.GID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"math/bits"
+)
+
+// phashFrames is maximum count of frames hashed per video, taken one per
+// second from the start.
+const phashFrames = 4
+
+// hashDistance returns mean Hamming distance of frame hashes of two videos,
+// comparing frames at same positions.
+func hashDistance(a, b []uint64) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	if n == 0 {
+		// Nothing to compare, treating as completely different.
+		return 64
+	}
+	total := 0
+	for i := 0; i < n; i++ {
+		total += bits.OnesCount64(a[i] ^ b[i])
+	}
+	return total / n
+}
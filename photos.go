@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/query/photos"
+	"github.com/gotd/td/tg"
+	"golang.org/x/xerrors"
+)
+
+// photosCmd downloads profile photo history of current user or of user
+// provided as argument (username, phone or link).
+func photosCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	return func(ctx context.Context, a *app) error {
+		var user tg.InputUserClass = &tg.InputUserSelf{}
+		dir := filepath.Join("photos", "self")
+		if peer := fs.Arg(0); peer != "" {
+			u, err := message.NewSender(a.api).Resolve(peer).AsInputUser(ctx)
+			if err != nil {
+				return xerrors.Errorf("resolve %q: %w", peer, err)
+			}
+			user = u
+			dir = filepath.Join("photos", fmt.Sprintf("%d", u.UserID))
+		}
+
+		return a.download(ctx, pipeline{
+			Source: func(ctx context.Context, files chan<- file) error {
+				iter := photos.NewQueryBuilder(a.api).GetUserPhotos(user).BatchSize(100).Iter()
+				for iter.Next(ctx) {
+					photo, ok := iter.Value().Photo.AsNotEmpty()
+					if !ok {
+						continue
+					}
+					f, ok := photoFile(dir, "photos", photo)
+					if !ok {
+						continue
+					}
+					f.Sidecar = true
+					if err := send(ctx, files, f); err != nil {
+						return err
+					}
+				}
+				if err := iter.Err(); err != nil {
+					return xerrors.Errorf("get: %w", err)
+				}
+				return nil
+			},
+		})
+	}
+}
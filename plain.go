@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"text/tabwriter"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// table writes tab-separated columns.
+type table interface {
+	io.Writer
+	Flush() error
+}
+
+// plainTable writes columns separated by single space instead of aligning
+// them with padding.
+type plainTable struct {
+	w io.Writer
+}
+
+func (t plainTable) Write(p []byte) (int, error) {
+	if _, err := t.w.Write(bytes.ReplaceAll(p, []byte("\t"), []byte(" "))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (t plainTable) Flush() error { return nil }
+
+// newTable returns table writing to w, aligned unless plain, which disables
+// alignment so output is line per row, e.g. for screen readers.
+func newTable(w io.Writer, plain bool) table {
+	if plain {
+		return plainTable{w: w}
+	}
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+}
+
+// newLogger creates logger of Info level, which if plain writes single line
+// per event without timestamps, callers and tabs.
+func newLogger(plain bool) *zap.Logger {
+	if !plain {
+		log, _ := zap.NewDevelopment(zap.IncreaseLevel(zapcore.InfoLevel), zap.AddStacktrace(zapcore.FatalLevel))
+		return log
+	}
+	cfg := zap.NewDevelopmentConfig()
+	cfg.Level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	cfg.DisableCaller = true
+	cfg.DisableStacktrace = true
+	cfg.EncoderConfig.TimeKey = ""
+	cfg.EncoderConfig.ConsoleSeparator = " "
+	log, _ := cfg.Build()
+	return log
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// posterCodecs maps poster formats to ffmpeg image codecs.
+var posterCodecs = map[string][]string{
+	"jpg": {"-c:v", "mjpeg", "-q:v", "2"},
+	"png": {"-c:v", "png"},
+}
+
+// checkPoster validates poster options.
+func (o options) checkPoster() error {
+	if _, ok := posterCodecs[o.PosterFormat]; !ok {
+		return xerrors.Errorf("unsupported poster format %q", o.PosterFormat)
+	}
+	if o.PosterFrame != "first" && o.PosterFrame != "middle" {
+		return xerrors.Errorf("unsupported poster frame %q", o.PosterFrame)
+	}
+	if o.Convert != "" && convertFormats[o.Convert].ext() == "."+o.PosterFormat {
+		return xerrors.Errorf("poster and %s rendition would have same name", o.Convert)
+	}
+	return nil
+}
+
+// posterName returns name of poster of video.
+func (a *app) posterName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + "." + a.opt.PosterFormat
+}
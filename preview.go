@@ -0,0 +1,13 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// previewName returns name of preview clip of video, stored in "previews"
+// directory next to it.
+func previewName(name string) string {
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	return filepath.Join(filepath.Dir(name), "previews", base+".mp4")
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/gotd/contrib/middleware/ratelimit"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"golang.org/x/xerrors"
+)
+
+// account is connected Telegram account.
+type account struct {
+	// Profile name, empty for default session.
+	Profile string
+	API     *tg.Client
+	// Invoker is raw invoker of API, e.g. for methods missing in schema.
+	Invoker tg.Invoker
+	// Self is user of account.
+	Self *tg.User
+}
+
+// profileDir returns directory of named profile where its session and state
+// are stored, i.e. "profiles/<name>" in session directory.
+func profileDir(name string) (string, error) {
+	dir, ok := os.LookupEnv("SESSION_DIR")
+	if !ok {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			home = "."
+		}
+		dir = filepath.Join(home, ".td")
+	}
+	return filepath.Abs(filepath.Join(dir, "profiles", name))
+}
+
+// newClient creates client for profile, using default session from
+// environment if profile is empty.
+func (a *app) newClient(profile string) (*telegram.Client, error) {
+	opts := telegram.Options{
+		Logger: a.log,
+		Middlewares: []telegram.Middleware{
+			ratelimit.New(rate.Every(a.opt.Rate), a.opt.RateBurst),
+		},
+	}
+	a.networkState(profile).apply(&opts)
+	if a.opt.Trace {
+		opts.Middlewares = append(opts.Middlewares, tracer{log: a.log.Named("trace")})
+	}
+	if a.recorder != nil {
+		opts.Middlewares = append(opts.Middlewares, a.recorder.Profile(profile))
+	}
+	if profile != "" {
+		dir, err := profileDir(profile)
+		if err != nil {
+			return nil, xerrors.Errorf("profile dir: %w", err)
+		}
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return nil, xerrors.Errorf("profile dir: %w", err)
+		}
+		opts.SessionStorage = &session.FileStorage{
+			Path: filepath.Join(dir, "session.json"),
+		}
+	}
+
+	if a.opt.ReadOnly {
+		opts.Middlewares = append(opts.Middlewares, readOnly{})
+		// Resolving default session storage to wrap it.
+		var err error
+		if opts, err = telegram.OptionsFromEnvironment(opts); err != nil {
+			return nil, err
+		}
+		opts.SessionStorage = readOnlyStorage{Storage: opts.SessionStorage}
+	}
+
+	// Initializing client from environment.
+	// Available environment variables:
+	// 	APP_ID:         app_id of Telegram app.
+	// 	APP_HASH:       app_hash of Telegram app.
+	// 	SESSION_FILE:   path to session file, if no profile is used
+	// 	SESSION_DIR:    path to session directory, if SESSION_FILE is not set
+	return telegram.ClientFromEnvironment(opts)
+}
+
+// connect connects and authenticates all profiles one by one, calling f
+// when all of them are ready.
+func (a *app) connect(ctx context.Context, profiles []string, f func(ctx context.Context, clients []*telegram.Client) error) error {
+	var clients []*telegram.Client
+
+	var next func(ctx context.Context) error
+	next = func(ctx context.Context) error {
+		if len(clients) == len(profiles) {
+			return f(ctx, clients)
+		}
+
+		profile := profiles[len(clients)]
+		client, err := a.newClient(profile)
+		if err != nil {
+			return err
+		}
+
+		// Setting up authentication flow.
+		// Current flow will read phone, code and 2FA password from terminal.
+		flow := auth.NewFlow(terminalAuth{prompt: a.prompt}, auth.SendCodeOptions{})
+
+		return client.Run(ctx, func(ctx context.Context) error {
+			if profile != "" {
+				a.log.Info("Using profile", zap.String("profile", profile))
+			}
+			if a.opt.ReadOnly {
+				// Authentication would change session.
+				status, err := client.Auth().Status(ctx)
+				if err != nil {
+					return xerrors.Errorf("auth status %q: %w", profile, err)
+				}
+				if !status.Authorized {
+					return xerrors.Errorf("profile %q is not authorized, log in without --read-only first", profile)
+				}
+			} else if err := client.Auth().IfNecessary(ctx, flow); err != nil {
+				// Perform auth if no session is available.
+				return xerrors.Errorf("auth %q: %w", profile, err)
+			}
+
+			// Creating new RPC client.
+			//
+			// The tg.Client is generated from Telegram schema and implements
+			// invocation of all defined Telegram MTProto methods on top of tg.Invoker.
+			// E.g. api.MessagesSendMessage() is messages.sendMessage method.
+			//
+			// The tg.Invoker interface is implemented by client (telegram.Client) and
+			// allows calling any MTProto method, like that:
+			//	Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error
+			self, err := client.Self(ctx)
+			if err != nil {
+				return xerrors.Errorf("self %q: %w", profile, err)
+			}
+			a.saveNetworkState(profile, client)
+			a.accounts = append(a.accounts, account{Profile: profile, API: client.API(), Invoker: client, Self: self})
+			clients = append(clients, client)
+			return next(ctx)
+		})
+	}
+
+	return next(ctx)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// accountOf returns account f belongs to.
+func (a *app) accountOf(f file) (account, bool) {
+	api := a.fileAPI(f)
+	for _, acc := range a.accounts {
+		if acc.API == api {
+			return acc, true
+		}
+	}
+	return account{}, false
+}
+
+// provenanceTags returns mp4 metadata tags describing origin of f.
+func (a *app) provenanceTags(f file) [][2]string {
+	tags := [][2]string{
+		{"creation_time", f.Meta.Date.UTC().Format(time.RFC3339)},
+		{"comment", "Telegram document " + strconv.FormatInt(f.Meta.ID, 10)},
+		{"telegram_document_id", strconv.FormatInt(f.Meta.ID, 10)},
+		{"telegram_date", f.Meta.Date.UTC().Format(time.RFC3339)},
+		{"telegram_source", f.Meta.Source},
+	}
+	if acc, ok := a.accountOf(f); ok && acc.Self != nil {
+		name := strconv.Itoa(acc.Self.ID)
+		if acc.Self.Username != "" {
+			name += " @" + acc.Self.Username
+		}
+		tags = append(tags, [2]string{"telegram_account", name})
+	}
+	return tags
+}
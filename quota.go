@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// transferUsage is cumulative size of downloads and uploads of profile in
+// current day and month, stored across runs.
+type transferUsage struct {
+	Day        string `json:"day"`
+	DayBytes   int64  `json:"day_bytes"`
+	Month      string `json:"month"`
+	MonthBytes int64  `json:"month_bytes"`
+}
+
+// roll resets counters of periods that passed before now.
+func (u *transferUsage) roll(now time.Time) {
+	if day := now.Format("2006-01-02"); u.Day != day {
+		u.Day, u.DayBytes = day, 0
+	}
+	if month := now.Format("2006-01"); u.Month != month {
+		u.Month, u.MonthBytes = month, 0
+	}
+}
+
+// transferUsagePath returns path of transfer usage of profile.
+func transferUsagePath(profile string) (string, error) {
+	lock, err := sessionLockPath(profile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(lock), "usage.json"), nil
+}
+
+// transfers tracks transfer usage of profiles.
+type transfers struct {
+	mux      sync.Mutex
+	profiles map[string]*transferUsage
+}
+
+// get returns usage of profile, loading it on first call. Must be called
+// with lock held.
+func (u *transfers) get(profile string) (*transferUsage, error) {
+	if t, ok := u.profiles[profile]; ok {
+		return t, nil
+	}
+	path, err := transferUsagePath(profile)
+	if err != nil {
+		return nil, err
+	}
+	t := &transferUsage{}
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(data, t); err != nil {
+			return nil, xerrors.Errorf("decode: %w", err)
+		}
+	}
+	if u.profiles == nil {
+		u.profiles = map[string]*transferUsage{}
+	}
+	u.profiles[profile] = t
+	return t, nil
+}
+
+// Month returns bytes transferred by profile in month of now.
+func (u *transfers) Month(profile string, now time.Time) (int64, error) {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	t, err := u.get(profile)
+	if err != nil {
+		return 0, err
+	}
+	t.roll(now)
+	return t.MonthBytes, nil
+}
+
+// Add adds n transferred bytes to usage of profile.
+func (u *transfers) Add(store storage, profile string, now time.Time, n int64) error {
+	u.mux.Lock()
+	defer u.mux.Unlock()
+
+	t, err := u.get(profile)
+	if err != nil {
+		return err
+	}
+	t.roll(now)
+	t.DayBytes += n
+	t.MonthBytes += n
+
+	path, err := transferUsagePath(profile)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := store.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return store.WriteFile(path, append(data, '\n'), 0o600)
+}
+
+// profileOf returns profile of connected account api belongs to.
+func (a *app) profileOf(api *tg.Client) string {
+	for _, acc := range a.accounts {
+		if acc.API == api {
+			return acc.Profile
+		}
+	}
+	return ""
+}
+
+// addTransfer records n bytes transferred by profile.
+func (a *app) addTransfer(profile string, n int64) {
+	if a.opt.ReadOnly {
+		return
+	}
+	if err := a.transfers.Add(a.store, profile, a.clock.Now(), n); err != nil {
+		a.log.Warn("Failed to save transfer usage", zap.String("profile", profile), zap.Error(err))
+	}
+}
+
+// waitQuota holds transfer of profile until next month if monthly quota is
+// exceeded.
+func (a *app) waitQuota(ctx context.Context, profile string) error {
+	if a.opt.MonthlyQuota == 0 {
+		return nil
+	}
+	for {
+		now := a.clock.Now()
+		used, err := a.transfers.Month(profile, now)
+		if err != nil {
+			return xerrors.Errorf("usage: %w", err)
+		}
+		if used < int64(a.opt.MonthlyQuota) {
+			return nil
+		}
+		next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, now.Location())
+		a.log.Warn("Monthly transfer quota exceeded, pausing until next month (Ctrl-C to stop)",
+			zap.String("profile", profile),
+			zap.Int64("used", used),
+			zap.Stringer("quota", a.opt.MonthlyQuota),
+			zap.Time("until", next),
+		)
+		if err := a.sleep(ctx, next.Sub(now)); err != nil {
+			return err
+		}
+	}
+}
+
+// waitTransfer holds transfer of profile until it is allowed by transfer
+// window and quota.
+func (a *app) waitTransfer(ctx context.Context, profile string) error {
+	if err := a.waitWindow(ctx); err != nil {
+		return err
+	}
+	return a.waitQuota(ctx, profile)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/session"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"golang.org/x/xerrors"
+)
+
+// readOnlyPrefixes are prefixes of names of methods not changing anything
+// on Telegram side.
+var readOnlyPrefixes = []string{"get", "search", "resolve", "check"}
+
+// readOnlyMethods are methods allowed in read-only mode in addition to ones
+// with readOnlyPrefixes, used internally by client.
+var readOnlyMethods = map[string]struct{}{
+	"invokeWithLayer":          {},
+	"initConnection":           {},
+	"auth.exportAuthorization": {},
+	"auth.importAuthorization": {},
+}
+
+// readOnlyAllowed reports whether method of TL name is allowed in read-only
+// mode.
+func readOnlyAllowed(name string) bool {
+	if _, ok := readOnlyMethods[name]; ok {
+		return true
+	}
+	method := name[strings.LastIndex(name, ".")+1:]
+	for _, prefix := range readOnlyPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnly is middleware rejecting calls of methods that can change state
+// of account, e.g. send messages or save gifs.
+type readOnly struct{}
+
+// Handle implements telegram.Middleware.
+func (readOnly) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		if name := methodName(input); !readOnlyAllowed(name) {
+			return xerrors.Errorf("read-only mode: %q is not allowed", name)
+		}
+		return next.Invoke(ctx, input, output)
+	}
+}
+
+// readOnlyStorage is session storage that never writes session.
+type readOnlyStorage struct {
+	session.Storage
+}
+
+// StoreSession implements session.Storage.
+func (readOnlyStorage) StoreSession(ctx context.Context, data []byte) error {
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// refresher updates location (and document) of f with fresh file reference.
+type refresher func(ctx context.Context, f *file) error
+
+// refreshDocument updates f from doc, which is fresh copy of f.Doc.
+func refreshDocument(f *file, doc *tg.Document) {
+	f.Doc = doc
+	f.Location = doc.AsInputDocumentFileLocation()
+}
+
+// savedGifRefresher returns refresher of saved gifs of api.
+func savedGifRefresher(api *tg.Client) refresher {
+	return func(ctx context.Context, f *file) error {
+		docs, err := listSavedGifs(ctx, api)
+		if err != nil {
+			return err
+		}
+		for _, doc := range docs {
+			if doc.ID == f.Meta.ID {
+				refreshDocument(f, doc)
+				return nil
+			}
+		}
+		return xerrors.New("gif is not saved anymore")
+	}
+}
+
+// messageRefresher returns refresher of media of message with msgID from
+// peer history.
+func messageRefresher(api *tg.Client, peer tg.InputPeerClass, msgID int) refresher {
+	return func(ctx context.Context, f *file) error {
+		ids := []tg.InputMessageClass{&tg.InputMessageID{ID: msgID}}
+		var (
+			result tg.MessagesMessagesClass
+			err    error
+		)
+		if ch, ok := peer.(*tg.InputPeerChannel); ok {
+			result, err = api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+				Channel: &tg.InputChannel{ChannelID: ch.ChannelID, AccessHash: ch.AccessHash},
+				ID:      ids,
+			})
+		} else {
+			result, err = api.MessagesGetMessages(ctx, ids)
+		}
+		if err != nil {
+			return err
+		}
+		modified, ok := result.AsModified()
+		if !ok {
+			return xerrors.New("message not found")
+		}
+		for _, m := range modified.GetMessages() {
+			msg, ok := m.(*tg.Message)
+			if !ok || msg.ID != msgID {
+				continue
+			}
+			fresh, ok := messageFile("", "", msg)
+			if !ok {
+				return xerrors.New("message has no media anymore")
+			}
+			f.Location, f.Doc = fresh.Location, fresh.Doc
+			return nil
+		}
+		return xerrors.New("message not found")
+	}
+}
+
+// referenceExpired reports whether err is caused by expired file reference.
+func referenceExpired(err error) bool {
+	rpcErr, ok := tgerr.As(err)
+	return ok && strings.HasPrefix(rpcErr.Type, "FILE_REFERENCE_")
+}
+
+// fetch downloads f to name, retrying failed attempts with exponential
+// backoff and refreshing expired file reference, if f supports it.
+//
+// Only errors of classes enabled by options are retried, up to MaxRetries
+// times, with backoff starting at RetryInitial doubled up to RetryMax.
+//
+// Broken documents are reported by non-empty reason, so they are not
+// retried.
+func (a *app) fetch(ctx context.Context, d *downloader.Downloader, f *file, name string) (reason string, err error) {
+	backoff := a.opt.RetryInitial
+	for attempt := 1; ; attempt++ {
+		_, err = d.Download(a.fileAPI(*f), f.Location).ToPath(ctx, name)
+		if reason := brokenDownload(name, err); reason != "" || err == nil {
+			return reason, nil
+		}
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		if retry, waitErr := a.waitFlood(ctx, err); waitErr != nil {
+			return "", waitErr
+		} else if retry {
+			// Flood waits are not failures of document.
+			attempt--
+			continue
+		}
+		if _, ok := a.retryOn[errorClass(err)]; !ok || attempt > a.opt.MaxRetries {
+			return "", err
+		}
+
+		if referenceExpired(err) && f.Refresh != nil {
+			a.log.Info("Refreshing file reference", zap.Int64("id", f.Meta.ID))
+			if err := f.Refresh(ctx, f); err != nil {
+				return "", xerrors.Errorf("refresh: %w", err)
+			}
+			continue
+		}
+		a.log.Warn("Download failed, retrying",
+			zap.Int64("id", f.Meta.ID),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+		if err := a.sleep(ctx, backoff); err != nil {
+			return "", err
+		}
+		if backoff *= 2; backoff > a.opt.RetryMax {
+			backoff = a.opt.RetryMax
+		}
+	}
+}
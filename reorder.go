@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// readManifestIDs reads document IDs from manifest, which is either CSV
+// with "id" column (as written by "list --csv") or plain text with single ID
+// per line. Empty lines and lines starting with "#" are ignored.
+func readManifestIDs(name string) ([]int64, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	if strings.HasPrefix(string(data), listHeader[0]+",") {
+		records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+		if err != nil {
+			return nil, xerrors.Errorf("csv: %w", err)
+		}
+		for _, r := range records[1:] {
+			id, err := strconv.ParseInt(r[0], 10, 64)
+			if err != nil {
+				return nil, xerrors.Errorf("invalid id %q", r[0])
+			}
+			ids = append(ids, id)
+		}
+		return ids, nil
+	}
+
+	s := bufio.NewScanner(strings.NewReader(string(data)))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		id, err := strconv.ParseInt(line, 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid id %q", line)
+		}
+		ids = append(ids, id)
+	}
+	return ids, s.Err()
+}
+
+// resaveGifs saves again saved gifs with provided ids in order, so last one
+// becomes first in gif panel. Returns count of re-saved
+// gifs, ids that are not saved are skipped.
+func (a *app) resaveGifs(ctx context.Context, ids []int64, interval time.Duration) (int, error) {
+	docs, err := listSavedGifs(ctx, a.api)
+	if err != nil {
+		return 0, err
+	}
+	saved := map[int64]int{}
+	for i, doc := range docs {
+		saved[doc.ID] = i
+	}
+
+	resaved := 0
+	for _, id := range ids {
+		i, ok := saved[id]
+		if !ok {
+			a.log.Warn("Gif is not saved, skipping", zap.Int64("id", id))
+			continue
+		}
+		doc := docs[i]
+
+		// Saving already saved gif moves it to the top, while unsaving it
+		// first could lose it if save fails.
+		if err := a.retryFlood(ctx, func(ctx context.Context) error {
+			return saveGif(ctx, a.api, doc, false)
+		}); err != nil {
+			return 0, xerrors.Errorf("save %d: %w", id, err)
+		}
+		resaved++
+		a.log.Info("Re-saved", zap.Int64("id", id))
+
+		if err := a.sleep(ctx, interval); err != nil {
+			return 0, err
+		}
+	}
+	return resaved, nil
+}
+
+// reorderCmd re-saves saved gifs in manifest order, so last listed gif
+// becomes first in gif panel.
+func reorderCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		reverse  = fs.Bool("reverse", false, "manifest lists newest-desired first, e.g. \"list --csv\" output")
+		interval = fs.Duration("interval", time.Second, "delay between saves")
+	)
+	return func(ctx context.Context, a *app) error {
+		if fs.NArg() != 1 {
+			return xerrors.New("usage: reorder [flags] <manifest>")
+		}
+		ids, err := readManifestIDs(fs.Arg(0))
+		if err != nil {
+			return xerrors.Errorf("manifest: %w", err)
+		}
+		if *reverse {
+			for i, j := 0, len(ids)-1; i < j; i, j = i+1, j-1 {
+				ids[i], ids[j] = ids[j], ids[i]
+			}
+		}
+
+		reordered, err := a.resaveGifs(ctx, ids, *interval)
+		if err != nil {
+			return err
+		}
+
+		a.log.Info("Reorder finished",
+			zap.Int("reordered", reordered),
+			zap.Int("total", len(ids)),
+		)
+		return nil
+	}
+}
+
+// bumpCmd re-saves provided saved gifs, so they are shown first in gif
+// panel in order of arguments.
+func bumpCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	interval := fs.Duration("interval", time.Second, "delay between saves")
+	return func(ctx context.Context, a *app) error {
+		if fs.NArg() == 0 {
+			return xerrors.New("usage: bump [flags] <id>...")
+		}
+		// Saving in reverse, so first argument ends up on top.
+		ids := make([]int64, fs.NArg())
+		for i, arg := range fs.Args() {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return xerrors.Errorf("invalid id %q", arg)
+			}
+			ids[len(ids)-1-i] = id
+		}
+
+		bumped, err := a.resaveGifs(ctx, ids, *interval)
+		if err != nil {
+			return err
+		}
+		if bumped != len(ids) {
+			return xerrors.Errorf("bumped %d of %d gifs, others are not saved", bumped, len(ids))
+		}
+		return nil
+	}
+}
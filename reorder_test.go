@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+func TestReorder(t *testing.T) {
+	m := newMockInvoker()
+	mockSavedGifs(m, testGif(1, 320, 240), testGif(2, 480, 270))
+	var saved []int64
+	m.On(tg.MessagesSaveGifRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+		r := req.(*tg.MessagesSaveGifRequest)
+		if r.Unsave {
+			t.Errorf("Gif %d is unsaved", r.ID.(*tg.InputDocument).ID)
+		}
+		saved = append(saved, r.ID.(*tg.InputDocument).ID)
+		return &tg.BoolTrue{}, nil
+	})
+	a := newTestApp(t, m)
+	manifest := filepath.Join(t.TempDir(), "order.txt")
+	if err := os.WriteFile(manifest, []byte("2\n# not saved\n3\n1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runCommand(context.Background(), a, "reorder", "--interval", "0", manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 2 || saved[0] != 2 || saved[1] != 1 {
+		t.Errorf("Saved %v, expected [2 1]", saved)
+	}
+}
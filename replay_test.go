@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+var update = flag.Bool("update", false, "record fixtures in testdata from mocks")
+
+// runFixture runs command replaying fixture from testdata. With -update
+// fixture is recorded from mocks of profiles first.
+func runFixture(t *testing.T, fixture string, mocks map[string]*mockInvoker, name string, args ...string) *app {
+	t.Helper()
+	a := newTestApp(t, nil)
+	path := filepath.Join("testdata", fixture+".jsonl")
+	if *update {
+		a.invoker = func(profile string) tg.Invoker { return mocks[profile] }
+		a.opt.Record = path
+	} else {
+		a.opt.Replay = path
+	}
+	if err := runCommand(context.Background(), a, name, args...); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// mockUploads sets handlers of uploads to saved gifs, saving them as
+// documents with IDs starting from id.
+func mockUploads(m *mockInvoker, id int64) {
+	m.On(tg.UploadSaveFilePartRequestTypeID, func(bin.Encoder) (bin.Encoder, error) {
+		return &tg.BoolTrue{}, nil
+	})
+	m.On(tg.MessagesSendMediaRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+		r := req.(*tg.MessagesSendMediaRequest)
+		msgID := int(id)
+		msg := sentGif(msgID, id)
+		id++
+		return &tg.Updates{Updates: []tg.UpdateClass{
+			&tg.UpdateMessageID{ID: msgID, RandomID: r.RandomID},
+			&tg.UpdateNewMessage{Message: msg},
+		}}, nil
+	})
+	m.On(tg.MessagesSaveGifRequestTypeID, func(bin.Encoder) (bin.Encoder, error) {
+		return &tg.BoolTrue{}, nil
+	})
+	m.On(tg.MessagesDeleteMessagesRequestTypeID, func(bin.Encoder) (bin.Encoder, error) {
+		return &tg.MessagesAffectedMessages{Pts: 1, PtsCount: 1}, nil
+	})
+}
+
+// checkContent checks that file at name has contents of document.
+func checkContent(t *testing.T, name string, id int64) {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(testContent(id)) {
+		t.Errorf("%s: got contents %q", name, data)
+	}
+}
+
+func TestReplayDownload(t *testing.T) {
+	for _, tt := range []struct {
+		Name string
+		Args []string
+	}{
+		{Name: "Download"},
+		{Name: "Remove", Args: []string{"--rm"}},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			m := newMockInvoker()
+			mockSavedGifs(m, testGif(1, 320, 240), testGif(2, 480, 270))
+			m.On(tg.MessagesSaveGifRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+				if !req.(*tg.MessagesSaveGifRequest).Unsave {
+					t.Error("Gif is saved instead of removal")
+				}
+				return &tg.BoolTrue{}, nil
+			})
+
+			a := runFixture(t, "download-"+tt.Name, map[string]*mockInvoker{"": m}, "download", tt.Args...)
+			for _, id := range []int64{1, 2} {
+				checkContent(t, filepath.Join(a.opt.Out, fmt.Sprintf("%d.mp4", id)), id)
+			}
+		})
+	}
+}
+
+func TestReplayUpload(t *testing.T) {
+	m := newMockInvoker()
+	mockSavedGifs(m)
+	mockUploads(m, 100)
+
+	input := filepath.Join(t.TempDir(), "input")
+	if err := os.MkdirAll(input, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(input, "1.mp4")
+	if err := os.WriteFile(name, testContent(1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runFixture(t, "upload", map[string]*mockInvoker{"": m}, "download", "--input", input)
+	checkContent(t, name, 1)
+	if after, err := os.Stat(name); err != nil {
+		t.Fatal(err)
+	} else if after.Mode() != stat.Mode() || !after.ModTime().Equal(stat.ModTime()) {
+		t.Error("Input file is changed")
+	}
+}
+
+func TestReplayMirror(t *testing.T) {
+	from := newMockInvoker()
+	mockSavedGifs(from, testGif(1, 320, 240), testGif(2, 480, 270))
+	to := newMockInvoker()
+	// Gif 3 is same as gif 2, gif 4 is missing in source.
+	mockSavedGifs(to, testGif(3, 480, 270), testGif(4, 100, 100))
+	mockUploads(to, 100)
+
+	a := runFixture(t, "mirror", map[string]*mockInvoker{"from": from, "to": to}, "mirror",
+		"--profile", "from", "--profile", "to", "--apply", "--delete",
+	)
+	checkContent(t, filepath.Join(a.opt.Out, "mirror", "from", "1.mp4"), 1)
+	if fileExists(filepath.Join(a.opt.Out, "mirror", "from", "2.mp4")) {
+		t.Error("Mirrored gif is downloaded")
+	}
+}
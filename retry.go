@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gotd/td/tgerr"
+	"golang.org/x/xerrors"
+)
+
+// retryClasses are classes of errors retry can be enabled for.
+var retryClasses = map[string]struct{}{
+	// network is transport error, e.g. connection reset or timeout.
+	"network": {},
+	// server is internal server error, i.e. RPC error with code 500 or
+	// more.
+	"server": {},
+	// reference is expired file reference, which is refreshed if possible.
+	"reference": {},
+	// rpc is any other RPC error.
+	"rpc": {},
+}
+
+// errorClass returns retry class of error.
+func errorClass(err error) string {
+	rpcErr, ok := tgerr.As(err)
+	switch {
+	case !ok:
+		return "network"
+	case rpcErr.Code >= 500:
+		return "server"
+	case referenceExpired(err):
+		return "reference"
+	default:
+		return "rpc"
+	}
+}
+
+// parseRetryOn parses comma-separated list of retry classes.
+func parseRetryOn(s string) (map[string]struct{}, error) {
+	classes := map[string]struct{}{}
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if _, ok := retryClasses[c]; !ok {
+			var known []string
+			for k := range retryClasses {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, xerrors.Errorf("unknown error class %q, expected %s", c, strings.Join(known, ", "))
+		}
+		classes[c] = struct{}{}
+	}
+	return classes, nil
+}
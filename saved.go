@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/gotd/td/telegram/query/messages"
+	"github.com/gotd/td/tg"
+	"golang.org/x/xerrors"
+)
+
+// historyMedia returns source of all media from peer history, stored in
+// type-based subdirectories of dir.
+func (a *app) historyMedia(peer tg.InputPeerClass, dir, source string) source {
+	return func(ctx context.Context, files chan<- file) error {
+		iter := messages.NewQueryBuilder(a.api).GetHistory(peer).BatchSize(100).Iter()
+		for iter.Next(ctx) {
+			elem := iter.Value()
+			msg, ok := elem.Msg.(*tg.Message)
+			if !ok {
+				continue
+			}
+			f, ok := messageFile(dir, source, msg)
+			if !ok {
+				continue
+			}
+			setSender(&f, msg, elem.Entities)
+			f.Refresh = messageRefresher(a.api, peer, msg.ID)
+			f.Sidecar = true
+			if err := send(ctx, files, f); err != nil {
+				return err
+			}
+		}
+		if err := iter.Err(); err != nil {
+			return xerrors.Errorf("history: %w", err)
+		}
+		return nil
+	}
+}
+
+// savedMessagesCmd downloads all media from "Saved Messages" to
+// "saved/<kind>" directories.
+func savedMessagesCmd(_ *flag.FlagSet) func(ctx context.Context, a *app) error {
+	return func(ctx context.Context, a *app) error {
+		return a.download(ctx, pipeline{
+			Source: a.historyMedia(&tg.InputPeerSelf{}, "saved", "saved-messages"),
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// searchGifs returns up to limit gifs found by inline bot for query.
+func (a *app) searchGifs(ctx context.Context, bot, query string, limit int) ([]*tg.Document, error) {
+	user, err := message.NewSender(a.api).Resolve(bot).AsInputUser(ctx)
+	if err != nil {
+		return nil, xerrors.Errorf("resolve bot %q: %w", bot, err)
+	}
+
+	var (
+		docs   []*tg.Document
+		offset string
+	)
+	for len(docs) < limit {
+		result, err := a.api.MessagesGetInlineBotResults(ctx, &tg.MessagesGetInlineBotResultsRequest{
+			Bot:    user,
+			Peer:   &tg.InputPeerSelf{},
+			Query:  query,
+			Offset: offset,
+		})
+		if err != nil {
+			return nil, xerrors.Errorf("get results: %w", err)
+		}
+
+		for _, r := range result.Results {
+			// Results with external content are just links, skipping them
+			// as they can't be downloaded or saved as documents.
+			media, ok := r.(*tg.BotInlineMediaResult)
+			if !ok {
+				continue
+			}
+			doc, ok := media.Document.AsNotEmpty()
+			if !ok {
+				continue
+			}
+			docs = append(docs, doc)
+			if len(docs) == limit {
+				break
+			}
+		}
+		if result.NextOffset == "" || len(result.Results) == 0 {
+			break
+		}
+		offset = result.NextOffset
+	}
+
+	return docs, nil
+}
+
+// safeName replaces characters that are not safe for file names.
+func safeName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		if r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+// parseSelection parses 1-based selection like "1,3-5" or "all" of n items,
+// returning 0-based indexes.
+func parseSelection(s string, n int) ([]int, error) {
+	s = strings.TrimSpace(s)
+	if s == "all" {
+		idx := make([]int, n)
+		for i := range idx {
+			idx[i] = i
+		}
+		return idx, nil
+	}
+
+	var idx []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to := part, part
+		if i := strings.Index(part, "-"); i > 0 {
+			from, to = part[:i], part[i+1:]
+		}
+		start, err := strconv.Atoi(from)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid selection %q", part)
+		}
+		end, err := strconv.Atoi(to)
+		if err != nil {
+			return nil, xerrors.Errorf("invalid selection %q", part)
+		}
+		if start < 1 || end > n || start > end {
+			return nil, xerrors.Errorf("selection %q out of range 1-%d", part, n)
+		}
+		for i := start; i <= end; i++ {
+			idx = append(idx, i-1)
+		}
+	}
+	return idx, nil
+}
+
+// searchGifsCmd searches gifs via inline bot, lists results and downloads
+// or saves selected ones.
+func searchGifsCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		bot       = fs.String("bot", "@gif", "inline bot to query")
+		limit     = fs.Int("limit", 20, "maximum results")
+		selection = fs.String("select", "", "results to download, e.g. 1,3-5 or all (prompted if empty)")
+		top       = fs.Int("top", 0, "select first N results without prompting")
+		save      = fs.Bool("save", false, "save selected results to saved gifs instead of downloading")
+	)
+	return func(ctx context.Context, a *app) error {
+		if fs.NArg() != 1 {
+			return xerrors.New("usage: search-gifs [flags] <query>")
+		}
+		query := fs.Arg(0)
+
+		docs, err := a.searchGifs(ctx, *bot, query, *limit)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			a.log.Info("Nothing found", zap.String("query", query))
+			return nil
+		}
+		for i, doc := range docs {
+			m := documentMetadata("", doc)
+			fmt.Print(trf("%3d. %d %dx%d %ds %d bytes\n", i+1, doc.ID, m.Width, m.Height, int(m.Duration), doc.Size))
+		}
+
+		if *top > 0 {
+			if *top > len(docs) {
+				*top = len(docs)
+			}
+			*selection = fmt.Sprintf("1-%d", *top)
+		}
+		if *selection == "" {
+			if *selection, err = a.prompt.Prompt(tr("Select results (e.g. 1,3-5 or all): ")); err != nil {
+				return err
+			}
+		}
+		idx, err := parseSelection(*selection, len(docs))
+		if err != nil {
+			return err
+		}
+
+		if *save {
+			// Saving in reverse order, so first result ends up on top of
+			// saved gifs.
+			for i := len(idx) - 1; i >= 0; i-- {
+				doc := docs[idx[i]]
+				if err := saveGif(ctx, a.api, doc, false); err != nil {
+					return xerrors.Errorf("save: %w", err)
+				}
+				a.log.Info("Saved", zap.Int64("id", doc.ID))
+			}
+			return nil
+		}
+
+		dir := filepath.Join("search", safeName(query))
+		return a.download(ctx, pipeline{
+			Source: func(ctx context.Context, files chan<- file) error {
+				for _, i := range idx {
+					f := documentFile(dir, "search-gifs", docs[i])
+					f.Sidecar = true
+					if err := send(ctx, files, f); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// version of telegifdl, set on release build by
+// -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
+// releasesURL is GitHub API URL of latest release.
+const releasesURL = "https://api.github.com/repos/ernado/telegifdl/releases/latest"
+
+// checksumsAsset is name of release asset with SHA-256 checksums of other
+// assets, in sha256sum format.
+const checksumsAsset = "checksums.txt"
+
+// release is GitHub release.
+type release struct {
+	Tag    string `json:"tag_name"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// asset returns download URL of release asset.
+func (r release) asset(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+// binaryAsset returns name of release binary for current platform.
+func binaryAsset() string {
+	name := fmt.Sprintf("telegifdl_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// httpGet returns body of successful GET request to url.
+func httpGet(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		_ = res.Body.Close()
+		return nil, xerrors.Errorf("%s: %s", url, res.Status)
+	}
+	return res.Body, nil
+}
+
+// latestRelease fetches latest release.
+func latestRelease(ctx context.Context) (release, error) {
+	body, err := httpGet(ctx, releasesURL)
+	if err != nil {
+		return release{}, err
+	}
+	defer func() { _ = body.Close() }()
+
+	var r release
+	if err := json.NewDecoder(body).Decode(&r); err != nil {
+		return release{}, xerrors.Errorf("decode: %w", err)
+	}
+	return r, nil
+}
+
+// releaseChecksum returns expected SHA-256 of asset from checksums of
+// release.
+func releaseChecksum(ctx context.Context, r release, asset string) (string, error) {
+	url, ok := r.asset(checksumsAsset)
+	if !ok {
+		return "", xerrors.Errorf("release %s has no %s", r.Tag, checksumsAsset)
+	}
+	body, err := httpGet(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = body.Close() }()
+
+	s := bufio.NewScanner(body)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == asset {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := s.Err(); err != nil {
+		return "", err
+	}
+	return "", xerrors.Errorf("no checksum of %s", asset)
+}
+
+// replaceExecutable downloads url next to running executable, verifies its
+// checksum and replaces executable with it.
+func replaceExecutable(ctx context.Context, url, checksum string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+
+	body, err := httpGet(ctx, url)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = body.Close() }()
+
+	tmp := filepath.Join(filepath.Dir(exe), "."+filepath.Base(exe)+".new")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o755)
+	if err != nil {
+		return err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return xerrors.Errorf("download: %w", err)
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != checksum {
+		_ = os.Remove(tmp)
+		return xerrors.Errorf("checksum mismatch: got %s, expected %s", got, checksum)
+	}
+
+	if runtime.GOOS == "windows" {
+		// Running executable can't be replaced, but can be renamed.
+		old := exe + ".old"
+		_ = os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// selfUpdateCmd replaces running binary with latest release one.
+func selfUpdateCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		check = fs.Bool("check", false, "only check for new release")
+		force = fs.Bool("force", false, "update even if version is same or unknown")
+	)
+	return func(ctx context.Context, a *app) error {
+		r, err := latestRelease(ctx)
+		if err != nil {
+			return xerrors.Errorf("release: %w", err)
+		}
+		if r.Tag == version && !*force {
+			fmt.Print(trf("telegifdl %s is up to date\n", version))
+			return nil
+		}
+		fmt.Print(trf("telegifdl %s is available (current is %s)\n", r.Tag, version))
+		if *check {
+			return nil
+		}
+		if version == "dev" && !*force {
+			return xerrors.New("current binary is development build, use --force to replace it")
+		}
+
+		asset := binaryAsset()
+		url, ok := r.asset(asset)
+		if !ok {
+			return xerrors.Errorf("release %s has no %s", r.Tag, asset)
+		}
+		checksum, err := releaseChecksum(ctx, r, asset)
+		if err != nil {
+			return xerrors.Errorf("checksum: %w", err)
+		}
+		if err := replaceExecutable(ctx, url, checksum); err != nil {
+			return xerrors.Errorf("replace: %w", err)
+		}
+		a.log.Info("Updated", zap.String("version", r.Tag))
+		return nil
+	}
+}
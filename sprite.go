@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+// spriteGrid is size of sprite sheet grid, e.g. "4x4".
+type spriteGrid struct {
+	Columns int
+	Rows    int
+}
+
+func (g spriteGrid) String() string {
+	if g.Columns == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dx%d", g.Columns, g.Rows)
+}
+
+func (g *spriteGrid) Set(v string) error {
+	parts := strings.Split(strings.ToLower(v), "x")
+	if len(parts) != 2 {
+		return xerrors.Errorf("invalid grid %q", v)
+	}
+	c, err1 := strconv.Atoi(parts[0])
+	r, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || c <= 0 || r <= 0 {
+		return xerrors.Errorf("invalid grid %q", v)
+	}
+	g.Columns, g.Rows = c, r
+	return nil
+}
+
+// spriteFrame is single frame of sprite sheet.
+type spriteFrame struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	// Time of frame in seconds.
+	Time float64 `json:"time"`
+}
+
+// spriteMap describes sprite sheet layout and is stored as JSON near it.
+type spriteMap struct {
+	Image       string        `json:"image"`
+	Columns     int           `json:"columns"`
+	Rows        int           `json:"rows"`
+	FrameWidth  int           `json:"frame_width"`
+	FrameHeight int           `json:"frame_height"`
+	Frames      []spriteFrame `json:"frames"`
+}
+
+// spriteName returns name of sprite sheet of video, stored in "sprites"
+// directory next to it.
+func spriteName(name string) string {
+	base := strings.TrimSuffix(filepath.Base(name), filepath.Ext(name))
+	return filepath.Join(filepath.Dir(name), "sprites", base+".jpg")
+}
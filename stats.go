@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+)
+
+// gifStats is summary of saved gifs metadata.
+type gifStats struct {
+	Count    int
+	Size     int64
+	Duration float64
+	// Years is count of gifs per year of upload.
+	Years map[int]int
+	// Aspects is count of gifs per aspect ratio class.
+	Aspects map[string]int
+	// Largest are largest gifs, biggest first.
+	Largest []metadata
+}
+
+// aspectClass returns rough aspect ratio class of w×h video.
+func aspectClass(w, h int) string {
+	if w <= 0 || h <= 0 {
+		return "unknown"
+	}
+	r := float64(w) / float64(h)
+	switch {
+	case r < 0.7:
+		return "portrait (<0.7)"
+	case r < 0.95:
+		return "tall (0.7-0.95)"
+	case r <= 1.05:
+		return "square (0.95-1.05)"
+	case r < 1.5:
+		return "wide (1.05-1.5)"
+	default:
+		return "landscape (>=1.5)"
+	}
+}
+
+// computeStats computes stats of metadata, keeping top largest gifs.
+func computeStats(all []metadata, top int) gifStats {
+	s := gifStats{
+		Years:   map[int]int{},
+		Aspects: map[string]int{},
+	}
+	for _, m := range all {
+		s.Count++
+		s.Size += int64(m.Size)
+		s.Duration += m.Duration
+		s.Years[m.Date.Year()]++
+		s.Aspects[aspectClass(m.Width, m.Height)]++
+	}
+
+	s.Largest = append([]metadata(nil), all...)
+	sort.SliceStable(s.Largest, func(i, j int) bool {
+		return s.Largest[i].Size > s.Largest[j].Size
+	})
+	if len(s.Largest) > top {
+		s.Largest = s.Largest[:top]
+	}
+	return s
+}
+
+// writeReport writes human-readable stats report.
+func (s gifStats) writeReport(tw table, detailed bool) error {
+	_, _ = fmt.Fprint(tw, trf("Gifs:\t%d\n", s.Count))
+	_, _ = fmt.Fprint(tw, trf("Total size:\t%s\n", byteSize(s.Size)))
+	if s.Count > 0 {
+		_, _ = fmt.Fprint(tw, trf("Average size:\t%s\n", byteSize(s.Size/int64(s.Count))))
+		_, _ = fmt.Fprint(tw, trf("Average duration:\t%.1fs\n", s.Duration/float64(s.Count)))
+	}
+	if !detailed {
+		return tw.Flush()
+	}
+
+	years := make([]int, 0, len(s.Years))
+	for y := range s.Years {
+		years = append(years, y)
+	}
+	sort.Ints(years)
+	_, _ = fmt.Fprintln(tw, tr("\nPer year of upload:"))
+	for _, y := range years {
+		_, _ = fmt.Fprintf(tw, "  %d\t%d\n", y, s.Years[y])
+	}
+
+	aspects := make([]string, 0, len(s.Aspects))
+	for a := range s.Aspects {
+		aspects = append(aspects, a)
+	}
+	sort.Slice(aspects, func(i, j int) bool {
+		return s.Aspects[aspects[i]] > s.Aspects[aspects[j]]
+	})
+	_, _ = fmt.Fprintln(tw, tr("\nAspect ratio:"))
+	for _, a := range aspects {
+		_, _ = fmt.Fprintf(tw, "  %s\t%d\t%.1f%%\n", a, s.Aspects[a], 100*float64(s.Aspects[a])/float64(s.Count))
+	}
+
+	_, _ = fmt.Fprintln(tw, tr("\nLargest:"))
+	for _, m := range s.Largest {
+		_, _ = fmt.Fprintf(tw, "  %d\t%s\t%gs\t%dx%d\n", m.ID, byteSize(m.Size), m.Duration, m.Width, m.Height)
+	}
+	return tw.Flush()
+}
+
+// statsCmd prints stats of saved gifs, using only metadata.
+func statsCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		detailed = fs.Bool("detailed", false, "report per-year counts, aspect ratios and largest gifs")
+		top      = fs.Int("top", 10, "count of largest gifs in detailed report")
+	)
+	return func(ctx context.Context, a *app) error {
+		docs, err := listSavedGifs(ctx, a.api)
+		if err != nil {
+			return err
+		}
+		all := make([]metadata, 0, len(docs))
+		for _, doc := range docs {
+			all = append(all, documentMetadata("gifs", doc))
+		}
+		return computeStats(all, *top).writeReport(newTable(os.Stdout, a.opt.Plain), *detailed)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tdp"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// stickerSources are sources of "stickers" command.
+var stickerSources = map[string]func(a *app, args []string) (source, error){
+	"recent": func(a *app, _ []string) (source, error) {
+		return a.recentStickers, nil
+	},
+	"faved": func(a *app, _ []string) (source, error) {
+		return a.favedStickers, nil
+	},
+	"set": func(a *app, args []string) (source, error) {
+		if len(args) != 1 {
+			return nil, xerrors.New("usage: stickers set <shortname>")
+		}
+		return a.stickerSet(args[0]), nil
+	},
+	"installed": func(a *app, _ []string) (source, error) {
+		return a.installedStickerSets, nil
+	},
+}
+
+// stickersCmd downloads stickers from requested source with sidecar
+// metadata.
+func stickersCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		tgsFormat = fs.String("tgs", "", "render animated .tgs stickers to format (gif, webm)")
+		renderer  = fs.String("lottie", "lottie_convert.py", "lottie renderer command for -tgs")
+	)
+	return func(ctx context.Context, a *app) error {
+		name := fs.Arg(0)
+		newSource, ok := stickerSources[name]
+		if !ok {
+			return xerrors.Errorf("unknown stickers source %q", name)
+		}
+		source, err := newSource(a, fs.Args()[1:])
+		if err != nil {
+			return err
+		}
+
+		p := pipeline{Source: source}
+		if *tgsFormat != "" {
+			if *tgsFormat != "gif" && *tgsFormat != "webm" {
+				return xerrors.Errorf("unsupported -tgs format %q", *tgsFormat)
+			}
+			p.Done = func(ctx context.Context, f file) error {
+				if f.Doc == nil || f.Doc.MimeType != "application/x-tgsticker" {
+					return nil
+				}
+				out, err := renderLottie(ctx, a.store, *renderer, *tgsFormat, filepath.Join(a.opt.Out, f.Name))
+				if err != nil {
+					// Rendering is best-effort, original sticker is kept.
+					a.log.Warn("Failed to render sticker",
+						zap.String("name", f.Name),
+						zap.Error(err),
+					)
+					return nil
+				}
+				a.log.Info("Rendered sticker", zap.String("path", out))
+				return nil
+			}
+		}
+
+		return a.download(ctx, p)
+	}
+}
+
+// sendStickers sends all non-empty sticker documents to files, storing them
+// in dir.
+func sendStickers(ctx context.Context, files chan<- file, dir, source string, docs []tg.DocumentClass) error {
+	for _, doc := range docs {
+		doc, ok := doc.AsNotEmpty()
+		if !ok {
+			continue
+		}
+
+		f := documentFile(dir, source, doc)
+		f.Sidecar = true
+		if err := send(ctx, files, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recentStickers sends recently used stickers to files.
+func (a *app) recentStickers(ctx context.Context, files chan<- file) error {
+	result, err := a.api.MessagesGetRecentStickers(ctx, &tg.MessagesGetRecentStickersRequest{})
+	if err != nil {
+		return xerrors.Errorf("get: %w", err)
+	}
+	recent, ok := result.(*tg.MessagesRecentStickers)
+	if !ok {
+		// Not modified, nothing to do.
+		return nil
+	}
+	a.log.Info("Got recent stickers", zap.Int("count", len(recent.Stickers)))
+
+	return sendStickers(ctx, files, filepath.Join("stickers", "recent"), "stickers/recent", recent.Stickers)
+}
+
+// favedStickers sends favorite stickers to files.
+func (a *app) favedStickers(ctx context.Context, files chan<- file) error {
+	result, err := a.api.MessagesGetFavedStickers(ctx, 0)
+	if err != nil {
+		return xerrors.Errorf("get: %w", err)
+	}
+	faved, ok := result.(*tg.MessagesFavedStickers)
+	if !ok {
+		// Not modified, nothing to do.
+		return nil
+	}
+	a.log.Info("Got faved stickers", zap.Int("count", len(faved.Stickers)))
+
+	return sendStickers(ctx, files, filepath.Join("stickers", "faved"), "stickers/faved", faved.Stickers)
+}
+
+// stickerSetIndex is index file of downloaded sticker set.
+type stickerSetIndex struct {
+	ID        int64              `json:"id"`
+	Title     string             `json:"title"`
+	ShortName string             `json:"short_name"`
+	Animated  bool               `json:"animated,omitempty"`
+	Masks     bool               `json:"masks,omitempty"`
+	Official  bool               `json:"official,omitempty"`
+	Stickers  []stickerIndexItem `json:"stickers"`
+}
+
+type stickerIndexItem struct {
+	ID    int64    `json:"id"`
+	File  string   `json:"file"`
+	MIME  string   `json:"mime"`
+	Emoji []string `json:"emoji,omitempty"`
+}
+
+// stickerSet returns source of all stickers from set with provided short
+// name, writing index.json to set directory.
+func (a *app) stickerSet(shortName string) source {
+	return func(ctx context.Context, files chan<- file) error {
+		set, err := a.api.MessagesGetStickerSet(ctx, &tg.InputStickerSetShortName{
+			ShortName: shortName,
+		})
+		if err != nil {
+			return xerrors.Errorf("get: %w", err)
+		}
+		a.log.Info("Got sticker set",
+			zap.String("title", set.Set.Title),
+			zap.Int("count", len(set.Documents)),
+		)
+
+		emoji := map[int64][]string{}
+		for _, pack := range set.Packs {
+			for _, id := range pack.Documents {
+				emoji[id] = append(emoji[id], pack.Emoticon)
+			}
+		}
+
+		dir := filepath.Join("stickers", "sets", set.Set.ShortName)
+		index := stickerSetIndex{
+			ID:        set.Set.ID,
+			Title:     set.Set.Title,
+			ShortName: set.Set.ShortName,
+			Animated:  set.Set.Animated,
+			Masks:     set.Set.Masks,
+			Official:  set.Set.Official,
+		}
+		for _, doc := range set.Documents {
+			doc, ok := doc.AsNotEmpty()
+			if !ok {
+				continue
+			}
+			index.Stickers = append(index.Stickers, stickerIndexItem{
+				ID:    doc.ID,
+				File:  fmt.Sprintf("%d%s", doc.ID, documentExt(doc)),
+				MIME:  doc.MimeType,
+				Emoji: emoji[doc.ID],
+			})
+		}
+
+		if err := a.store.MkdirAll(filepath.Join(a.opt.Out, dir), 0o750); err != nil {
+			return xerrors.Errorf("mkdir: %w", err)
+		}
+		data, err := json.MarshalIndent(index, "", "  ")
+		if err != nil {
+			return xerrors.Errorf("encode index: %w", err)
+		}
+		if err := a.store.WriteFile(filepath.Join(a.opt.Out, dir, "index.json"), append(data, '\n'), 0o640); err != nil {
+			return xerrors.Errorf("write index: %w", err)
+		}
+
+		return sendStickers(ctx, files, dir, "stickers/set", set.Documents)
+	}
+}
+
+// messagesGetEmojiStickersRequestTypeID is TL type id of
+// messagesGetEmojiStickersRequest.
+const messagesGetEmojiStickersRequestTypeID = 0xfbfca18f
+
+// messagesGetEmojiStickersRequest is messages.getEmojiStickers request,
+// listing installed custom emoji packs, which is missing in current schema.
+//
+// Response is messages.AllStickers, which server encodes in layer of
+// connection.
+type messagesGetEmojiStickersRequest struct {
+	Hash int64
+}
+
+// TypeInfo returns info about TL type.
+func (r *messagesGetEmojiStickersRequest) TypeInfo() tdp.Type {
+	return tdp.Type{
+		Name: "messages.getEmojiStickers",
+		ID:   messagesGetEmojiStickersRequestTypeID,
+	}
+}
+
+// Encode implements bin.Encoder.
+func (r *messagesGetEmojiStickersRequest) Encode(b *bin.Buffer) error {
+	b.PutID(messagesGetEmojiStickersRequestTypeID)
+	b.PutLong(r.Hash)
+	return nil
+}
+
+// Decode implements bin.Decoder.
+func (r *messagesGetEmojiStickersRequest) Decode(b *bin.Buffer) error {
+	if err := b.ConsumeID(messagesGetEmojiStickersRequestTypeID); err != nil {
+		return err
+	}
+	hash, err := b.Long()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	return nil
+}
+
+// installedStickerSets sends stickers of all installed sets and custom
+// emoji packs, fetching every set separately so each one gets own directory
+// and index.
+func (a *app) installedStickerSets(ctx context.Context, files chan<- file) error {
+	result, err := a.api.MessagesGetAllStickers(ctx, 0)
+	if err != nil {
+		return xerrors.Errorf("get: %w", err)
+	}
+	var sets []tg.StickerSet
+	if all, ok := result.(*tg.MessagesAllStickers); ok {
+		sets = all.Sets
+	}
+	a.log.Info("Got installed sticker sets", zap.Int("count", len(sets)))
+
+	// Custom emoji packs are not listed by messages.getAllStickers.
+	var emoji tg.MessagesAllStickersBox
+	if err := a.accounts[0].Invoker.Invoke(ctx, &messagesGetEmojiStickersRequest{}, &emoji); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// Method can be unsupported by server or account, so regular sets
+		// are still downloaded.
+		a.log.Warn("Failed to get installed emoji packs", zap.Error(err))
+	} else if all, ok := emoji.AllStickers.(*tg.MessagesAllStickers); ok {
+		a.log.Info("Got installed emoji packs", zap.Int("count", len(all.Sets)))
+		sets = append(sets, all.Sets...)
+	}
+
+	for _, set := range sets {
+		if err := a.stickerSet(set.ShortName)(ctx, files); err != nil {
+			return xerrors.Errorf("set %q: %w", set.ShortName, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"golang.org/x/xerrors"
+)
+
+func TestInstalledStickerSets(t *testing.T) {
+	m := newMockInvoker()
+	fetched := mockSavedGifs(m)
+	m.On(tg.MessagesGetAllStickersRequestTypeID, func(bin.Encoder) (bin.Encoder, error) {
+		return &tg.MessagesAllStickers{Sets: []tg.StickerSet{{ID: 1, ShortName: "cats", Title: "Cats"}}}, nil
+	})
+	m.On(messagesGetEmojiStickersRequestTypeID, func(bin.Encoder) (bin.Encoder, error) {
+		// Emoji packs are not supported, e.g. by older layer.
+		return nil, xerrors.New("METHOD_INVALID")
+	})
+	m.On(tg.MessagesGetStickerSetRequestTypeID, func(bin.Encoder) (bin.Encoder, error) {
+		return &tg.MessagesStickerSet{
+			Set:       tg.StickerSet{ID: 1, ShortName: "cats", Title: "Cats"},
+			Documents: []tg.DocumentClass{testGif(5, 512, 512)},
+		}, nil
+	})
+
+	a := newTestApp(t, m)
+	if err := runCommand(context.Background(), a, "stickers", "installed"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fetched(); len(got) != 1 || got[0] != 5 {
+		t.Errorf("Fetched %v", got)
+	}
+	dir := filepath.Join(a.opt.Out, "stickers", "sets", "cats")
+	if _, err := os.Stat(filepath.Join(dir, "index.json")); err != nil {
+		t.Error(err)
+	}
+	checkContent(t, filepath.Join(dir, "5.mp4"), 5)
+}
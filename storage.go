@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"go.uber.org/atomic"
+	"golang.org/x/xerrors"
+)
+
+// storage writes files of output, applying configured permissions to them.
+type storage interface {
+	// TempName returns name of temporary file with suffix to write name to
+	// before moving it in place by Replace.
+	TempName(name, suffix string) string
+	// TempDir returns directory of temporary files not related to output
+	// ones, empty for default one.
+	TempDir() string
+	// Replace moves temporary file tmp to name.
+	Replace(tmp, name string) error
+	// Rename moves output file from old path to name.
+	Rename(old, name string) error
+	// WriteFile writes data to name.
+	WriteFile(name string, data []byte, mode os.FileMode) error
+	// Create creates or truncates name.
+	Create(name string, mode os.FileMode) (*os.File, error)
+	// Append opens name for appending, creating it if it does not exist.
+	Append(name string, mode os.FileMode) (*os.File, error)
+	// MkdirAll creates directory with parents.
+	MkdirAll(dir string, mode os.FileMode) error
+}
+
+// diskStorage implements storage writing to local file system.
+type diskStorage struct {
+	// Perms are applied to written files and created directories.
+	Perms permissions
+	// Scratch is directory of temporary files, e.g. on fast local disk. If
+	// empty, temporary files are created next to output ones.
+	Scratch string
+
+	// seq makes names of temporary files in Scratch unique.
+	seq atomic.Int64
+}
+
+// newDiskStorage creates diskStorage keeping default permissions.
+func newDiskStorage() *diskStorage {
+	return &diskStorage{Perms: permissions{UID: -1, GID: -1}}
+}
+
+// TempName implements storage.
+func (s *diskStorage) TempName(name, suffix string) string {
+	if s.Scratch == "" {
+		return filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+suffix)
+	}
+	return filepath.Join(s.Scratch, fmt.Sprintf("%d-%s%s", s.seq.Inc(), filepath.Base(name), suffix))
+}
+
+// TempDir implements storage.
+func (s *diskStorage) TempDir() string {
+	return s.Scratch
+}
+
+// Replace implements storage, copying tmp if rename fails, e.g. because
+// scratch directory is on other volume.
+func (s *diskStorage) Replace(tmp, name string) error {
+	err := os.Rename(tmp, name)
+	if err == nil {
+		return s.Perms.apply(name, false)
+	}
+	if s.Scratch == "" {
+		_ = os.Remove(tmp)
+		return xerrors.Errorf("rename: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp) }()
+
+	// Copying next to name first, so name is replaced atomically.
+	local := filepath.Join(filepath.Dir(name), "."+filepath.Base(name)+".tmp")
+	if err := copyFile(tmp, local); err != nil {
+		_ = os.Remove(local)
+		return xerrors.Errorf("copy: %w", err)
+	}
+	if err := os.Rename(local, name); err != nil {
+		_ = os.Remove(local)
+		return xerrors.Errorf("rename: %w", err)
+	}
+	return s.Perms.apply(name, false)
+}
+
+// Rename implements storage.
+func (s *diskStorage) Rename(old, name string) error {
+	if err := os.Rename(old, name); err != nil {
+		return err
+	}
+	return s.Perms.apply(name, false)
+}
+
+// WriteFile implements storage.
+func (s *diskStorage) WriteFile(name string, data []byte, mode os.FileMode) error {
+	if err := os.WriteFile(name, data, mode); err != nil {
+		return err
+	}
+	return s.Perms.apply(name, false)
+}
+
+// Create implements storage.
+func (s *diskStorage) Create(name string, mode os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Perms.apply(name, false); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Append implements storage, applying permissions only to created file.
+func (s *diskStorage) Append(name string, mode os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_APPEND|os.O_WRONLY, mode)
+	if os.IsExist(err) {
+		return os.OpenFile(name, os.O_APPEND|os.O_WRONLY, mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Perms.apply(name, false); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// MkdirAll implements storage, applying permissions to created directories
+// only.
+func (s *diskStorage) MkdirAll(dir string, mode os.FileMode) error {
+	var created []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		created = append(created, d)
+	}
+	if err := os.MkdirAll(dir, mode); err != nil {
+		return err
+	}
+	for _, d := range created {
+		if err := s.Perms.apply(d, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupScratch creates unique subdirectory of dir for temporary files of
+// run, returning cleanup function removing it.
+func (s *diskStorage) setupScratch(dir string) (func(), error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, xerrors.Errorf("mkdir: %w", err)
+	}
+	tmp, err := os.MkdirTemp(dir, "telegifdl-")
+	if err != nil {
+		return nil, err
+	}
+	s.Scratch = tmp
+	return func() {
+		_ = os.RemoveAll(tmp)
+		s.Scratch = ""
+	}, nil
+}
+
+// copyFile copies contents of src to dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiskStoragePermissions(t *testing.T) {
+	store := newDiskStorage()
+	store.Perms.File = 0o640
+	store.Perms.Dir = 0o750
+
+	for _, tt := range []struct {
+		Name  string
+		Write func(name string) error
+	}{
+		{
+			Name: "WriteFile",
+			Write: func(name string) error {
+				return store.WriteFile(name, []byte("data"), 0o600)
+			},
+		},
+		{
+			Name: "Create",
+			Write: func(name string) error {
+				f, err := store.Create(name, 0o600)
+				if err != nil {
+					return err
+				}
+				return f.Close()
+			},
+		},
+		{
+			Name: "Append",
+			Write: func(name string) error {
+				f, err := store.Append(name, 0o600)
+				if err != nil {
+					return err
+				}
+				return f.Close()
+			},
+		},
+		{
+			Name: "Replace",
+			Write: func(name string) error {
+				tmp := store.TempName(name, ".tmp")
+				if err := os.WriteFile(tmp, []byte("data"), 0o600); err != nil {
+					return err
+				}
+				return store.Replace(tmp, name)
+			},
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "a", "b")
+			if err := store.MkdirAll(dir, 0o700); err != nil {
+				t.Fatal(err)
+			}
+			for _, d := range []string{dir, filepath.Dir(dir)} {
+				if stat, err := os.Stat(d); err != nil {
+					t.Fatal(err)
+				} else if mode := stat.Mode().Perm(); mode != 0o750 {
+					t.Errorf("Directory %s mode is %o", d, mode)
+				}
+			}
+
+			name := filepath.Join(dir, "file")
+			if err := tt.Write(name); err != nil {
+				t.Fatal(err)
+			}
+			if stat, err := os.Stat(name); err != nil {
+				t.Fatal(err)
+			} else if mode := stat.Mode().Perm(); mode != 0o640 {
+				t.Errorf("File mode is %o", mode)
+			}
+		})
+	}
+
+	t.Run("AppendExisting", func(t *testing.T) {
+		// Existing files, e.g. of other tools, are left as is.
+		name := filepath.Join(t.TempDir(), "file")
+		if err := os.WriteFile(name, []byte("data\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := store.Append(name, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteString("more\n"); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if stat, err := os.Stat(name); err != nil {
+			t.Fatal(err)
+		} else if mode := stat.Mode().Perm(); mode != 0o600 {
+			t.Errorf("File mode is %o", mode)
+		}
+		if data, err := os.ReadFile(name); err != nil {
+			t.Fatal(err)
+		} else if string(data) != "data\nmore\n" {
+			t.Errorf("Got %q", data)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// takeoutInvoker invokes all requests within takeout session.
+type takeoutInvoker struct {
+	id   int64
+	next tg.Invoker
+}
+
+func (t takeoutInvoker) Invoke(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+	query, ok := input.(bin.Object)
+	if !ok {
+		return xerrors.Errorf("unexpected request type %T", input)
+	}
+	return t.next.Invoke(ctx, &tg.InvokeWithTakeoutRequest{
+		TakeoutID: t.id,
+		Query:     query,
+	}, output)
+}
+
+// withTakeout initializes takeout session and calls f with invoker that
+// invokes all methods within that session, so bulk exports are subject to
+// export-friendly limits instead of regular flood limits.
+//
+// Session is finished after f returns, marking export as successful only
+// if f succeeded.
+func withTakeout(ctx context.Context, log *zap.Logger, invoker tg.Invoker, f func(ctx context.Context, invoker tg.Invoker) error) (rErr error) {
+	takeout, err := tg.NewClient(invoker).AccountInitTakeoutSession(ctx, &tg.AccountInitTakeoutSessionRequest{
+		MessageUsers:      true,
+		MessageChats:      true,
+		MessageMegagroups: true,
+		MessageChannels:   true,
+		Files:             true,
+		// Maximum allowed value, 2000MB.
+		FileMaxSize: 2000 << 20,
+	})
+	if err != nil {
+		if d, ok := tgerr.AsType(err, "TAKEOUT_INIT_DELAY"); ok {
+			return xerrors.Errorf("takeout requires confirmation from other client or waiting %s: %w",
+				time.Duration(d.Argument)*time.Second, err,
+			)
+		}
+		return xerrors.Errorf("init takeout: %w", err)
+	}
+	log.Info("Takeout session started", zap.Int64("id", takeout.ID))
+
+	invoker = takeoutInvoker{id: takeout.ID, next: invoker}
+	api := tg.NewClient(invoker)
+	defer func() {
+		// Using fresh context, so session is finished even on cancellation.
+		finishCtx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+		defer cancel()
+
+		if _, err := api.AccountFinishTakeoutSession(finishCtx, &tg.AccountFinishTakeoutSessionRequest{
+			Success: rErr == nil,
+		}); err != nil {
+			log.Warn("Failed to finish takeout session", zap.Error(err))
+			return
+		}
+		log.Info("Takeout session finished", zap.Int64("id", takeout.ID))
+	}()
+
+	return f(ctx, invoker)
+}
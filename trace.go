@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+)
+
+// encodedSize returns size of encoded TL object, or -1 if unknown.
+func encodedSize(v interface{}) int {
+	enc, ok := v.(bin.Encoder)
+	if !ok {
+		return -1
+	}
+	var b bin.Buffer
+	if err := enc.Encode(&b); err != nil {
+		return -1
+	}
+	return b.Len()
+}
+
+// tracer is middleware logging every RPC call with method name, sizes of
+// request and response, latency and error.
+//
+// Contents of requests and responses are never logged, so traces contain
+// no secrets, e.g. auth codes or passwords, and can be shared in bug
+// reports.
+type tracer struct {
+	log *zap.Logger
+}
+
+// Handle implements telegram.Middleware.
+func (t tracer) Handle(next tg.Invoker) telegram.InvokeFunc {
+	return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+		start := time.Now()
+		err := next.Invoke(ctx, input, output)
+		fields := []zap.Field{
+			zap.String("method", methodName(input)),
+			zap.Int("request_size", encodedSize(input)),
+			zap.Duration("latency", time.Since(start)),
+		}
+		if err == nil {
+			t.log.Info("RPC", append(fields, zap.Int("response_size", encodedSize(output)))...)
+			return nil
+		}
+		if rpcErr, ok := tgerr.As(err); ok {
+			fields = append(fields, zap.Int("code", rpcErr.Code), zap.String("error", rpcErr.Type))
+		} else {
+			fields = append(fields, zap.Error(err))
+		}
+		t.log.Info("RPC failed", fields...)
+		return err
+	}
+}
@@ -2,22 +2,42 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/binary"
 	"os"
 	"path"
 	"path/filepath"
 
 	"github.com/gotd/td/telegram/message"
-	"github.com/gotd/td/telegram/message/unpack"
 	"github.com/gotd/td/telegram/uploader"
 	"github.com/gotd/td/tg"
 	"go.uber.org/zap"
 	"golang.org/x/xerrors"
 )
 
-// upload lists inputDir and uploads all ".mp4" files to saved gifs.
-//
-// NB: Uses "Saved Messages" as temporary place for uploads.
-func upload(ctx context.Context, log *zap.Logger, api *tg.Client, inputDir string) error {
+// uploadOptions configure pre-upload processing.
+type uploadOptions struct {
+	// Store keeps temporary copies of processed files.
+	Store storage
+	// Validate enables skipping of corrupt files.
+	Validate bool
+	// Journal records uploads, so interrupted ones are completed.
+	Journal *journal
+	// Profile is profile of account, recorded in journal.
+	Profile string
+	// Wait is called before each upload, if set, e.g. to hold it until
+	// transfer window.
+	Wait func(ctx context.Context) error
+	// Transferred is called with size of each uploaded file, if set.
+	Transferred func(n int64)
+	// Watermark is image overlaid on uploaded gifs at Position, if set.
+	Watermark string
+	Position  string
+}
+
+// upload lists inputDir and uploads all ".mp4" files to saved gifs of
+// account of invoker.
+func upload(ctx context.Context, log *zap.Logger, invoker tg.Invoker, inputDir string, opt uploadOptions) error {
 	// Upload all gifs from requested dir.
 	entries, err := os.ReadDir(inputDir)
 	if err != nil {
@@ -36,46 +56,253 @@ func upload(ctx context.Context, log *zap.Logger, api *tg.Client, inputDir strin
 		zap.Int("count", len(names)),
 	)
 
-	u := uploader.NewUploader(api)
+	u := newGifUploader(log, invoker, opt)
+	var corrupt []string
 	for _, name := range names {
-		f, err := u.FromPath(ctx, name)
+		ok, err := u.Upload(ctx, name)
 		if err != nil {
 			return err
 		}
+		if !ok {
+			corrupt = append(corrupt, name)
+		}
+	}
+	if len(corrupt) > 0 {
+		log.Warn("Corrupt files were not uploaded", zap.Strings("names", corrupt))
+	}
+
+	return nil
+}
 
+// gifUploader uploads local mp4 files to saved gifs.
+//
+// NB: Uses "Saved Messages" as temporary place for uploads.
+type gifUploader struct {
+	log    *zap.Logger
+	api    *tg.Client
+	opt    uploadOptions
+	u      *uploader.Uploader
+	sender *message.RequestBuilder
+}
+
+// newGifUploader creates gifUploader for account of invoker.
+func newGifUploader(log *zap.Logger, invoker tg.Invoker, opt uploadOptions) *gifUploader {
+	api := tg.NewClient(invoker)
+	return &gifUploader{
+		log: log,
+		api: api,
+		opt: opt,
+		u:   uploader.NewUploader(api),
 		// Using "Saved messages" as upload buffer, because we can't directly
 		// upload gifs to "saved gifs".
-		sender := message.NewSender(api).Self()
-
-		// To be valid, media should have "animated" attribute and video/mp4
-		// MIME-type.
-		msg, err := unpack.Message(sender.Media(ctx, message.UploadedDocument(f).
-			Attributes(&tg.DocumentAttributeAnimated{}).
-			MIME("video/mp4"),
-		))
-		if err != nil {
-			return err
+		sender: message.NewSender(api).Self(),
+	}
+}
+
+// Upload uploads name to saved gifs, returning false if file is corrupt and
+// was skipped.
+func (g *gifUploader) Upload(ctx context.Context, name string) (bool, error) {
+	log, api, opt := g.log, g.api, g.opt
+
+	if opt.Validate {
+		if err := validateMP4(ctx, name); err != nil {
+			log.Warn("Skipping corrupt file", zap.String("name", name), zap.Error(err))
+			return false, nil
 		}
-		doc, ok := msg.Media.(*tg.MessageMediaDocument).Document.AsNotEmpty()
-		if !ok {
-			return xerrors.New("unexpected document")
+	}
+
+	if opt.Wait != nil {
+		if err := opt.Wait(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	// Processing temporary copy, keeping original.
+	src := name
+	if opt.Watermark != "" {
+		// Watermarked copy is encoded with moov in front.
+		var err error
+		if src, err = watermark(ctx, opt.Store, name, opt.Watermark, opt.Position); err != nil {
+			return false, xerrors.Errorf("watermark %s: %w", name, err)
 		}
+	} else if fast, err := faststart(ctx, opt.Store, name); err != nil {
+		log.Warn("Failed to move moov to front", zap.String("name", name), zap.Error(err))
+	} else if fast != name {
+		// Telegram clients play gifs instantly only if moov is in front.
+		log.Info("Remuxed for faststart", zap.String("name", name))
+		src = fast
+	}
+	var size int64
+	if stat, err := os.Stat(src); err == nil {
+		size = stat.Size()
+	}
+	f, err := g.u.FromPath(ctx, src)
+	if src != name {
+		_ = os.Remove(src)
+	}
+	if err != nil {
+		return false, err
+	}
+	if opt.Transferred != nil {
+		opt.Transferred(size)
+	}
 
-		// Actually saving GIF.
-		_, saveErr := api.MessagesSaveGif(ctx, &tg.MessagesSaveGifRequest{
-			ID:     doc.AsInput(),
-			Unsave: false,
+	// To be valid, media should have "animated" attribute and video/mp4
+	// MIME-type.
+	attrs := []tg.DocumentAttributeClass{&tg.DocumentAttributeAnimated{}}
+	if info, err := probeMP4(name); err == nil {
+		// Video attribute lets clients show gif before download.
+		attrs = append(attrs, &tg.DocumentAttributeVideo{
+			Duration: int(info.Duration + 0.5),
+			W:        info.Width,
+			H:        info.Height,
 		})
-		// Cleaning up "buffer" message.
-		if _, deleteErr := sender.Revoke().Messages(ctx, msg.ID); deleteErr != nil {
-			return xerrors.Errorf("delete: %w", deleteErr)
+	} else {
+		log.Warn("Failed to parse mp4", zap.String("name", name), zap.Error(err))
+	}
+	randomID, err := newRandomID()
+	if err != nil {
+		return false, xerrors.Errorf("random id: %w", err)
+	}
+	// Operation is journaled before sending, so buffer message is revoked
+	// on next run even if it crashes right after sending.
+	entry := journalEntry{Op: journalUpload, Profile: opt.Profile, Name: name}
+	seq, err := opt.Journal.Begin(entry)
+	if err != nil {
+		return false, xerrors.Errorf("journal: %w", err)
+	}
+	updates, err := api.MessagesSendMedia(ctx, &tg.MessagesSendMediaRequest{
+		Peer: &tg.InputPeerSelf{},
+		Media: &tg.InputMediaUploadedDocument{
+			File:       f,
+			MimeType:   "video/mp4",
+			Attributes: attrs,
+		},
+		RandomID: randomID,
+	})
+	if err != nil {
+		// Message ID is unknown, so there is nothing to recover.
+		_ = opt.Journal.Commit(seq)
+		return false, xerrors.Errorf("send: %w", err)
+	}
+	msgID, msg, err := sentMessage(updates, randomID)
+	if msgID == 0 {
+		_ = opt.Journal.Commit(seq)
+		return false, err
+	}
+	// revoke cleans up "buffer" message, completing operation.
+	revoke := func() error {
+		if _, err := g.sender.Revoke().Messages(ctx, msgID); err != nil {
+			return xerrors.Errorf("delete: %w", err)
 		}
-		// Checking for actual save error.
-		if saveErr != nil {
-			return xerrors.Errorf("save: %w", saveErr)
+		return opt.Journal.Commit(seq)
+	}
+
+	var doc *tg.Document
+	if err == nil {
+		doc, err = sentDocument(msg)
+	}
+	entry.MessageID = msgID
+	if doc != nil {
+		entry.DocID = doc.ID
+		entry.AccessHash = doc.AccessHash
+		entry.FileReference = doc.FileReference
+	}
+	if journalErr := opt.Journal.Update(seq, entry); journalErr != nil && err == nil {
+		err = xerrors.Errorf("journal: %w", journalErr)
+	}
+	if err != nil {
+		if revokeErr := revoke(); revokeErr != nil {
+			log.Warn("Failed to delete sent message", zap.Int("id", msgID), zap.Error(revokeErr))
 		}
-		log.Info("Saved", zap.String("name", name))
+		return false, err
 	}
 
-	return nil
+	// Actually saving GIF.
+	_, saveErr := api.MessagesSaveGif(ctx, &tg.MessagesSaveGifRequest{
+		ID:     doc.AsInput(),
+		Unsave: false,
+	})
+	if err := revoke(); err != nil {
+		return false, err
+	}
+	// Checking for actual save error.
+	if saveErr != nil {
+		return false, xerrors.Errorf("save: %w", saveErr)
+	}
+	log.Info("Saved", zap.String("name", name))
+
+	return true, nil
+}
+
+// newRandomID returns random ID of sent message.
+func newRandomID() (int64, error) {
+	var id int64
+	if err := binary.Read(rand.Reader, binary.LittleEndian, &id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// sentDocument returns document of sent message.
+func sentDocument(msg *tg.Message) (*tg.Document, error) {
+	media, ok := msg.Media.(*tg.MessageMediaDocument)
+	if !ok {
+		return nil, xerrors.Errorf("unexpected media %T", msg.Media)
+	}
+	doc, ok := media.Document.AsNotEmpty()
+	if !ok {
+		return nil, xerrors.New("unexpected document")
+	}
+	return doc, nil
+}
+
+// sentMessage returns message sent with randomID from updates returned by
+// send request. Updates can also contain other new messages, e.g. received
+// concurrently, so message is found by ID assigned to randomID. ID of
+// message is returned if it is known even if message itself is not found.
+func sentMessage(u tg.UpdatesClass, randomID int64) (int, *tg.Message, error) {
+	var updates []tg.UpdateClass
+	switch u := u.(type) {
+	case *tg.UpdateShortSentMessage:
+		// Sent message itself, without peer.
+		media, ok := u.GetMedia()
+		if !ok {
+			return u.ID, nil, xerrors.New("sent message has no media")
+		}
+		return u.ID, &tg.Message{Out: true, ID: u.ID, Date: u.Date, Media: media}, nil
+	case *tg.UpdateShort:
+		updates = []tg.UpdateClass{u.Update}
+	case *tg.Updates:
+		updates = u.Updates
+	case *tg.UpdatesCombined:
+		updates = u.Updates
+	default:
+		return 0, nil, xerrors.Errorf("unexpected updates %T", u)
+	}
+
+	id := 0
+	for _, update := range updates {
+		if update, ok := update.(*tg.UpdateMessageID); ok && update.RandomID == randomID {
+			id = update.ID
+		}
+	}
+	if id == 0 {
+		return 0, nil, xerrors.New("no ID of sent message in updates")
+	}
+	for _, update := range updates {
+		var msg tg.MessageClass
+		switch update := update.(type) {
+		case *tg.UpdateNewMessage:
+			msg = update.Message
+		case *tg.UpdateNewChannelMessage:
+			msg = update.Message
+		default:
+			continue
+		}
+		if m, ok := msg.(*tg.Message); ok && m.ID == id {
+			return id, m, nil
+		}
+	}
+	return id, nil, xerrors.Errorf("no sent message %d in updates", id)
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+)
+
+// sentGif returns new message of document in Saved Messages.
+func sentGif(id int, docID int64) *tg.Message {
+	return &tg.Message{
+		Out:    true,
+		ID:     id,
+		PeerID: &tg.PeerUser{UserID: testSelf.ID},
+		Media:  &tg.MessageMediaDocument{Document: &tg.Document{ID: docID, AccessHash: docID}},
+	}
+}
+
+func TestGifUploaderUpload(t *testing.T) {
+	for _, tt := range []struct {
+		Name string
+		// Updates returns result of sending message with randomID.
+		Updates func(randomID int64) tg.UpdatesClass
+		// Message and Doc are IDs of expected sent message and document,
+		// zero if upload fails.
+		Message int
+		Doc     int64
+		// Revoked is ID of message revoked after failed upload, if any.
+		Revoked int
+	}{
+		{
+			Name: "Updates",
+			Updates: func(randomID int64) tg.UpdatesClass {
+				return &tg.Updates{Updates: []tg.UpdateClass{
+					&tg.UpdateMessageID{ID: 10, RandomID: randomID},
+					&tg.UpdateNewMessage{Message: sentGif(10, 1)},
+				}}
+			},
+			Message: 10,
+			Doc:     1,
+		},
+		{
+			Name: "ConcurrentMessage",
+			Updates: func(randomID int64) tg.UpdatesClass {
+				// Message received concurrently comes first.
+				return &tg.Updates{Updates: []tg.UpdateClass{
+					&tg.UpdateNewMessage{Message: sentGif(9, 2)},
+					&tg.UpdateMessageID{ID: 9, RandomID: randomID + 1},
+					&tg.UpdateNewMessage{Message: sentGif(10, 1)},
+					&tg.UpdateMessageID{ID: 10, RandomID: randomID},
+				}}
+			},
+			Message: 10,
+			Doc:     1,
+		},
+		{
+			Name: "UpdatesCombined",
+			Updates: func(randomID int64) tg.UpdatesClass {
+				return &tg.UpdatesCombined{Updates: []tg.UpdateClass{
+					&tg.UpdateMessageID{ID: 10, RandomID: randomID},
+					&tg.UpdateNewMessage{Message: sentGif(10, 1)},
+				}}
+			},
+			Message: 10,
+			Doc:     1,
+		},
+		{
+			Name: "ShortSentMessage",
+			Updates: func(randomID int64) tg.UpdatesClass {
+				u := &tg.UpdateShortSentMessage{Out: true, ID: 10}
+				u.SetMedia(sentGif(10, 1).Media)
+				return u
+			},
+			Message: 10,
+			Doc:     1,
+		},
+		{
+			Name: "ShortSentMessageWithoutMedia",
+			Updates: func(randomID int64) tg.UpdatesClass {
+				return &tg.UpdateShortSentMessage{Out: true, ID: 10}
+			},
+			Revoked: 10,
+		},
+		{
+			Name: "UnexpectedMedia",
+			Updates: func(randomID int64) tg.UpdatesClass {
+				msg := sentGif(10, 1)
+				msg.Media = &tg.MessageMediaPhoto{}
+				return &tg.Updates{Updates: []tg.UpdateClass{
+					&tg.UpdateMessageID{ID: 10, RandomID: randomID},
+					&tg.UpdateNewMessage{Message: msg},
+				}}
+			},
+			Revoked: 10,
+		},
+		{
+			Name: "NoMessageID",
+			Updates: func(randomID int64) tg.UpdatesClass {
+				return &tg.Updates{Updates: []tg.UpdateClass{
+					&tg.UpdateNewMessage{Message: sentGif(10, 1)},
+				}}
+			},
+		},
+		{
+			Name: "OtherRandomID",
+			Updates: func(randomID int64) tg.UpdatesClass {
+				return &tg.Updates{Updates: []tg.UpdateClass{
+					&tg.UpdateMessageID{ID: 10, RandomID: randomID + 1},
+					&tg.UpdateNewMessage{Message: sentGif(10, 1)},
+				}}
+			},
+		},
+		{
+			Name: "NoMessage",
+			Updates: func(randomID int64) tg.UpdatesClass {
+				return &tg.Updates{Updates: []tg.UpdateClass{
+					&tg.UpdateMessageID{ID: 10, RandomID: randomID},
+				}}
+			},
+			Revoked: 10,
+		},
+	} {
+		t.Run(tt.Name, func(t *testing.T) {
+			var (
+				saved   int64
+				revoked []int
+			)
+			m := newMockInvoker()
+			m.On(tg.UploadSaveFilePartRequestTypeID, func(bin.Encoder) (bin.Encoder, error) {
+				return &tg.BoolTrue{}, nil
+			})
+			m.On(tg.MessagesSendMediaRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+				r := req.(*tg.MessagesSendMediaRequest)
+				if _, ok := r.Peer.(*tg.InputPeerSelf); !ok {
+					t.Errorf("Sent to %T", r.Peer)
+				}
+				return tt.Updates(r.RandomID), nil
+			})
+			m.On(tg.MessagesSaveGifRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+				saved = req.(*tg.MessagesSaveGifRequest).ID.(*tg.InputDocument).ID
+				return &tg.BoolTrue{}, nil
+			})
+			m.On(tg.MessagesDeleteMessagesRequestTypeID, func(req bin.Encoder) (bin.Encoder, error) {
+				revoked = append(revoked, req.(*tg.MessagesDeleteMessagesRequest).ID...)
+				return &tg.MessagesAffectedMessages{}, nil
+			})
+			a := newTestApp(t, m)
+			j, err := a.openJournal(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := filepath.Join(t.TempDir(), "gif.mp4")
+			if err := os.WriteFile(name, []byte("not really mp4"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			u := newGifUploader(a.log, m, uploadOptions{Store: a.store, Journal: j})
+			ok, err := u.Upload(context.Background(), name)
+			if tt.Message == 0 {
+				if err == nil {
+					t.Fatal("Expected error")
+				}
+				if saved != 0 {
+					t.Errorf("Saved %d", saved)
+				}
+				if tt.Revoked == 0 && len(revoked) != 0 {
+					t.Errorf("Revoked %v", revoked)
+				}
+				if tt.Revoked != 0 && (len(revoked) != 1 || revoked[0] != tt.Revoked) {
+					t.Errorf("Revoked %v, expected [%d]", revoked, tt.Revoked)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !ok {
+					t.Fatal("Not uploaded")
+				}
+				if saved != tt.Doc {
+					t.Errorf("Saved %d, expected %d", saved, tt.Doc)
+				}
+				if len(revoked) != 1 || revoked[0] != tt.Message {
+					t.Errorf("Revoked %v, expected [%d]", revoked, tt.Message)
+				}
+			}
+			pending, _, err := readJournal(j.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(pending) != 0 {
+				t.Errorf("Pending operations %v", pending)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"golang.org/x/xerrors"
+)
+
+// validateMP4 checks that mp4 file is structurally sound, i.e. has movie
+// header, media data and video track, and that its first frame decodes.
+//
+// Decoding is checked only if ffmpeg is built in and available.
+func validateMP4(ctx context.Context, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	root, err := mp4Boxes(f, 0, stat.Size())
+	_ = f.Close()
+	if err != nil {
+		return xerrors.Errorf("boxes: %w", err)
+	}
+	hasData := false
+	for _, b := range root {
+		if b.Type == "mdat" && b.Size > 0 {
+			hasData = true
+		}
+	}
+	if !hasData {
+		return xerrors.New("no media data")
+	}
+	info, err := probeMP4(name)
+	if err != nil {
+		return err
+	}
+	if info.Width == 0 || info.Height == 0 {
+		return xerrors.New("no video track")
+	}
+
+	if err := decodeFrame(ctx, name); err != nil {
+		return xerrors.Errorf("decode: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+// wallpapers is source of installed chat wallpapers, stored in
+// "wallpapers" directory. Pattern-less fill wallpapers have no file and are
+// skipped.
+func (a *app) wallpapers(ctx context.Context, files chan<- file) error {
+	result, err := a.api.AccountGetWallPapers(ctx, 0)
+	if err != nil {
+		return xerrors.Errorf("get wallpapers: %w", err)
+	}
+	papers, ok := result.(*tg.AccountWallPapers)
+	if !ok {
+		return nil
+	}
+	a.log.Info("Got wallpapers", zap.Int("count", len(papers.Wallpapers)))
+
+	for _, p := range papers.Wallpapers {
+		p, ok := p.(*tg.WallPaper)
+		if !ok {
+			continue
+		}
+		doc, ok := p.Document.AsNotEmpty()
+		if !ok {
+			continue
+		}
+		f := documentFile("wallpapers", "wallpapers", doc)
+		f.Meta.Title = p.Slug
+		f.Sidecar = true
+		if err := send(ctx, files, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// themes returns source of installed cloud themes of format, stored in
+// "themes" directory.
+func (a *app) themes(format string) source {
+	return func(ctx context.Context, files chan<- file) error {
+		result, err := a.api.AccountGetThemes(ctx, &tg.AccountGetThemesRequest{Format: format})
+		if err != nil {
+			return xerrors.Errorf("get themes: %w", err)
+		}
+		themes, ok := result.(*tg.AccountThemes)
+		if !ok {
+			return nil
+		}
+		a.log.Info("Got themes", zap.Int("count", len(themes.Themes)))
+
+		for _, t := range themes.Themes {
+			d, ok := t.GetDocument()
+			if !ok {
+				// Themes without file are defined by settings only.
+				continue
+			}
+			doc, ok := d.AsNotEmpty()
+			if !ok {
+				continue
+			}
+			f := documentFile("themes", "themes", doc)
+			f.Meta.Title = t.Title
+			f.Sidecar = true
+			if err := send(ctx, files, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// wallpapersCmd downloads installed chat wallpapers and theme files.
+func wallpapersCmd(fs *flag.FlagSet) func(ctx context.Context, a *app) error {
+	var (
+		format   = fs.String("theme-format", "tdesktop", "theme format: tdesktop, android, ios or macos")
+		noThemes = fs.Bool("no-themes", false, "download only wallpapers")
+	)
+	return func(ctx context.Context, a *app) error {
+		return a.download(ctx, pipeline{
+			Source: func(ctx context.Context, files chan<- file) error {
+				if err := a.wallpapers(ctx, files); err != nil {
+					return err
+				}
+				if *noThemes {
+					return nil
+				}
+				return a.themes(*format)(ctx, files)
+			},
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package main
+
+// watermarkPositions maps positions to ffmpeg overlay coordinates.
+var watermarkPositions = map[string]string{
+	"tl": "10:10",
+	"tr": "W-w-10:10",
+	"bl": "10:H-h-10",
+	"br": "W-w-10:H-h-10",
+	"c":  "(W-w)/2:(H-h)/2",
+}
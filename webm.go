@@ -0,0 +1,11 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// webmMP4Name returns name of mp4 copy of webm video.
+func webmMP4Name(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".mp4"
+}
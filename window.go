@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/xerrors"
+)
+
+const day = 24 * time.Hour
+
+// transferWindow is daily period of local time when bulk transfers are
+// allowed, e.g. 01:00-07:00. Window can cross midnight, e.g. 23:00-06:00.
+type transferWindow struct {
+	// From and To are offsets since midnight.
+	From, To time.Duration
+}
+
+// parseClock parses time of day in "15:04" format as offset since midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parseTransferWindow parses window in "01:00-07:00" format, empty string
+// is window of whole day.
+func parseTransferWindow(s string) (transferWindow, error) {
+	if s == "" {
+		return transferWindow{}, nil
+	}
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 {
+		return transferWindow{}, xerrors.Errorf("invalid transfer window %q, expected HH:MM-HH:MM", s)
+	}
+	var (
+		w   transferWindow
+		err error
+	)
+	if w.From, err = parseClock(parts[0]); err != nil {
+		return transferWindow{}, xerrors.Errorf("window start: %w", err)
+	}
+	if w.To, err = parseClock(parts[1]); err != nil {
+		return transferWindow{}, xerrors.Errorf("window end: %w", err)
+	}
+	if w.From == w.To {
+		return transferWindow{}, xerrors.Errorf("empty transfer window %q", s)
+	}
+	return w, nil
+}
+
+// Empty reports whether window allows transfers at any time.
+func (w transferWindow) Empty() bool {
+	return w.From == w.To
+}
+
+// Wait returns duration until start of window, zero if now is within it.
+func (w transferWindow) Wait(now time.Time) time.Duration {
+	if w.Empty() {
+		return 0
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	at := now.Sub(midnight)
+
+	var inside bool
+	if w.From < w.To {
+		inside = at >= w.From && at < w.To
+	} else {
+		inside = at >= w.From || at < w.To
+	}
+	if inside {
+		return 0
+	}
+	d := w.From - at
+	if d < 0 {
+		d += day
+	}
+	return d
+}
+
+// waitWindow holds transfer until transfer window starts.
+func (a *app) waitWindow(ctx context.Context) error {
+	d := a.window.Wait(a.clock.Now())
+	if d == 0 {
+		return nil
+	}
+	a.log.Info("Holding transfers until window",
+		zap.String("window", a.opt.TransferWindow),
+		zap.Duration("duration", d),
+	)
+	return a.sleep(ctx, d)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// xattrPrefix is prefix of extended attributes, "user" namespace is
+// writable by file owner on Linux.
+const xattrPrefix = "user.telegifdl."
+
+// errNoXattr means that extended attributes are not supported on platform.
+var errNoXattr = xerrors.New("extended attributes are not supported on this platform")
+
+// writeXattrs stores document ID, access hash, date and source of f in
+// extended attributes of name, so they are kept if file is moved without
+// sidecar.
+func writeXattrs(name string, f file) error {
+	attrs := [][2]string{
+		{"id", strconv.FormatInt(f.Meta.ID, 10)},
+		{"date", f.Meta.Date.UTC().Format(time.RFC3339)},
+	}
+	if f.Doc != nil {
+		attrs = append(attrs, [2]string{"access_hash", strconv.FormatInt(f.Doc.AccessHash, 10)})
+	}
+	if f.Meta.Source != "" {
+		attrs = append(attrs, [2]string{"source", f.Meta.Source})
+	}
+	for _, attr := range attrs {
+		if err := setXattr(name, xattrPrefix+attr[0], []byte(attr[1])); err != nil {
+			return xerrors.Errorf("%s: %w", attr[0], err)
+		}
+	}
+	return nil
+}
+
+// readXattrID returns document ID stored in extended attributes of name.
+func readXattrID(name string) (int64, bool) {
+	v, err := getXattr(name, xattrPrefix+"id")
+	if err != nil {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(string(v), 10, 64)
+	return id, err == nil
+}
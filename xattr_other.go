@@ -0,0 +1,18 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package main
+
+// xattrSupported reports whether extended attributes are supported on
+// platform.
+const xattrSupported = false
+
+// setXattr sets extended attribute of file.
+func setXattr(name, attr string, value []byte) error {
+	return errNoXattr
+}
+
+// getXattr returns extended attribute of file.
+func getXattr(name, attr string) ([]byte, error) {
+	return nil, errNoXattr
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// xattrSupported reports whether extended attributes are supported on
+// platform.
+const xattrSupported = true
+
+// setXattr sets extended attribute of file.
+func setXattr(name, attr string, value []byte) error {
+	return unix.Setxattr(name, attr, value, 0)
+}
+
+// getXattr returns extended attribute of file.
+func getXattr(name, attr string) ([]byte, error) {
+	buf := make([]byte, 256)
+	n, err := unix.Getxattr(name, attr, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// xmpName returns name of XMP sidecar of file, i.e. "<name>.xmp" without
+// original extension, as digital asset managers expect.
+func xmpName(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".xmp"
+}
+
+// xmpKeywords returns keywords of file described by m.
+func xmpKeywords(m metadata) []string {
+	var keywords []string
+	seen := map[string]struct{}{}
+	for _, k := range []string{"telegram", m.Source, m.Kind, m.Emoji, m.Performer} {
+		if _, ok := seen[k]; ok || k == "" {
+			continue
+		}
+		seen[k] = struct{}{}
+		keywords = append(keywords, k)
+	}
+	return keywords
+}
+
+// xmpTitle returns title of file described by m: first line of caption,
+// audio title or original file name.
+func xmpTitle(m metadata) string {
+	if m.Caption != "" {
+		return strings.TrimSpace(strings.SplitN(m.Caption, "\n", 2)[0])
+	}
+	if m.Title != "" {
+		return m.Title
+	}
+	return m.FileName
+}
+
+// writeXMP writes XMP sidecar for file at name described by m.
+func writeXMP(store storage, name string, m metadata) error {
+	var b bytes.Buffer
+	text := func(s string) {
+		_ = xml.EscapeText(&b, []byte(s))
+	}
+	alt := func(tag, s string) {
+		b.WriteString("   <" + tag + "><rdf:Alt><rdf:li xml:lang=\"x-default\">")
+		text(s)
+		b.WriteString("</rdf:li></rdf:Alt></" + tag + ">\n")
+	}
+
+	b.WriteString("<?xpacket begin=\"\ufeff\" id=\"W5M0MpCehiHzreSzNTczkc9d\"?>\n")
+	b.WriteString("<x:xmpmeta xmlns:x=\"adobe:ns:meta/\">\n")
+	b.WriteString(" <rdf:RDF xmlns:rdf=\"http://www.w3.org/1999/02/22-rdf-syntax-ns#\">\n")
+	b.WriteString("  <rdf:Description rdf:about=\"\"\n" +
+		"    xmlns:dc=\"http://purl.org/dc/elements/1.1/\"\n" +
+		"    xmlns:xmp=\"http://ns.adobe.com/xap/1.0/\"\n" +
+		"    xmlns:photoshop=\"http://ns.adobe.com/photoshop/1.0/\">\n")
+
+	date := m.Date.Format(time.RFC3339)
+	b.WriteString("   <xmp:CreateDate>" + date + "</xmp:CreateDate>\n")
+	b.WriteString("   <photoshop:DateCreated>" + date + "</photoshop:DateCreated>\n")
+	b.WriteString("   <dc:identifier>telegram:" + strconv.FormatInt(m.ID, 10) + "</dc:identifier>\n")
+	if m.MIME != "" {
+		b.WriteString("   <dc:format>")
+		text(m.MIME)
+		b.WriteString("</dc:format>\n")
+	}
+	if title := xmpTitle(m); title != "" {
+		alt("dc:title", title)
+	}
+	if m.Caption != "" {
+		alt("dc:description", m.Caption)
+	}
+	b.WriteString("   <dc:subject><rdf:Bag>\n")
+	for _, k := range xmpKeywords(m) {
+		b.WriteString("    <rdf:li>")
+		text(k)
+		b.WriteString("</rdf:li>\n")
+	}
+	b.WriteString("   </rdf:Bag></dc:subject>\n")
+
+	b.WriteString("  </rdf:Description>\n </rdf:RDF>\n</x:xmpmeta>\n<?xpacket end=\"w\"?>\n")
+
+	if err := store.WriteFile(xmpName(name), b.Bytes(), 0o640); err != nil {
+		return xerrors.Errorf("write: %w", err)
+	}
+	return nil
+}